@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultAPIRateLimit is requests per minute per API key (or client IP) when API_RATE_LIMIT is unset
+const defaultAPIRateLimit = 30
+
+// apiKeys are the keys accepted by requireAPIKey, set from API_KEYS
+var apiKeys map[string]bool
+
+// trustedAPIKeys may lift per-request limits such as max_slides, set from TRUSTED_API_KEYS
+var trustedAPIKeys map[string]bool
+
+// apiKeyMaxQuality caps the quality some keys may convert at, set from API_KEY_MAX_QUALITY
+var apiKeyMaxQuality map[string]QualityType
+
+// rejectOverQuality makes capped keys asking for more than their quality get
+// a 403 instead of a downgraded conversion, set from QUALITY_CAP_MODE
+var rejectOverQuality bool
+
+// loadAPIKeyMaxQuality parses API_KEY_MAX_QUALITY, comma-separated key:quality
+// pairs such as "free-key:SD"
+func loadAPIKeyMaxQuality() (map[string]QualityType, error) {
+	caps := make(map[string]QualityType)
+	for _, pair := range strings.Split(os.Getenv("API_KEY_MAX_QUALITY"), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, quality, ok := strings.Cut(pair, ":")
+		key = strings.TrimSpace(key)
+		q := QualityType(strings.ToUpper(strings.TrimSpace(quality)))
+		if !ok || key == "" || (q != HD && q != SD) {
+			return nil, fmt.Errorf("invalid API_KEY_MAX_QUALITY entry %q: must be key:HD or key:SD", pair)
+		}
+		caps[key] = q
+	}
+	return caps, nil
+}
+
+// loadQualityCapMode parses QUALITY_CAP_MODE, downgrade (the default) or reject
+func loadQualityCapMode() (bool, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("QUALITY_CAP_MODE"))); mode {
+	case "", "downgrade":
+		return false, nil
+	case "reject":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid QUALITY_CAP_MODE %q: must be downgrade or reject", mode)
+	}
+}
+
+// requestMaxQuality returns the quality cap of the request's API key, empty
+// when it has none
+func requestMaxQuality(c *fiber.Ctx) QualityType {
+	key := requestAPIKey(c)
+	if key == "" || (!apiKeys[key] && !trustedAPIKeys[key]) {
+		return ""
+	}
+	return apiKeyMaxQuality[key]
+}
+
+// loadAPIKeys parses a comma-separated key list from the named env var,
+// ignoring blanks
+func loadAPIKeys(name string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, key := range strings.Split(os.Getenv(name), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys[key] = true
+		}
+	}
+	return keys
+}
+
+// requestAPIKey returns the key sent in the X-API-Key header or the api_key query param
+func requestAPIKey(c *fiber.Ctx) string {
+	if key := strings.TrimSpace(c.Get("X-API-Key")); key != "" {
+		return key
+	}
+	return strings.TrimSpace(c.Query("api_key"))
+}
+
+// isTrustedRequest reports whether the request carries a TRUSTED_API_KEYS key
+func isTrustedRequest(c *fiber.Ctx) bool {
+	key := requestAPIKey(c)
+	return key != "" && trustedAPIKeys[key]
+}
+
+// requireAPIKey rejects requests without a key from API_KEYS or
+// TRUSTED_API_KEYS. Auth is off when API_KEYS is empty, for local development.
+func requireAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(apiKeys) == 0 {
+			return c.Next()
+		}
+
+		key := requestAPIKey(c)
+		if key == "" {
+			return &CustomAPIError{StatusCode: fiber.StatusUnauthorized, Code: CodeUnauthorized, Detail: "Missing API key"}
+		}
+		if !apiKeys[key] && !trustedAPIKeys[key] {
+			return &CustomAPIError{StatusCode: fiber.StatusUnauthorized, Code: CodeUnauthorized, Detail: "Invalid API key"}
+		}
+		return c.Next()
+	}
+}
+
+// requireTrustedAPIKey guards admin endpoints, accepting only keys from
+// TRUSTED_API_KEYS. Like requireAPIKey it lets everything through while no
+// keys are configured at all.
+func requireTrustedAPIKey() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if len(apiKeys) == 0 && len(trustedAPIKeys) == 0 {
+			return c.Next()
+		}
+
+		key := requestAPIKey(c)
+		if key == "" {
+			return &CustomAPIError{StatusCode: fiber.StatusUnauthorized, Code: CodeUnauthorized, Detail: "Missing API key"}
+		}
+		if !apiKeys[key] && !trustedAPIKeys[key] {
+			return &CustomAPIError{StatusCode: fiber.StatusUnauthorized, Code: CodeUnauthorized, Detail: "Invalid API key"}
+		}
+		if !trustedAPIKeys[key] {
+			return &CustomAPIError{StatusCode: fiber.StatusForbidden, Code: CodeForbidden, Detail: "This endpoint needs a trusted API key"}
+		}
+		return c.Next()
+	}
+}
+
+// rateLimitKey buckets requests by API key, but only for keys from API_KEYS
+// or TRUSTED_API_KEYS. Anything else, including every key while auth is
+// off, counts against the client IP so made-up keys can't mint fresh quota.
+func rateLimitKey(c *fiber.Ctx) string {
+	if key := requestAPIKey(c); key != "" && (apiKeys[key] || trustedAPIKeys[key]) {
+		return "key:" + key
+	}
+	return "ip:" + c.IP()
+}
+
+// rateWindow is one key's hits in the current fixed window
+type rateWindow struct {
+	hits    int
+	resetAt time.Time
+}
+
+// rateQuota is a fixed-window limit of max hits per key. Unlike fiber's
+// limiter it can charge several hits at once, so a batch pays for every
+// item it converts.
+type rateQuota struct {
+	mu      sync.Mutex
+	max     int
+	window  time.Duration
+	windows map[string]*rateWindow
+	sweptAt time.Time
+}
+
+func newRateQuota(max int, window time.Duration) *rateQuota {
+	return &rateQuota{max: max, window: window, windows: make(map[string]*rateWindow)}
+}
+
+// take charges n hits to key and reports the hits left and the time until
+// the window resets. A charge over the limit is refused whole, not counted.
+func (q *rateQuota) take(key string, n int, now time.Time) (int, time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Forget windows that have ended so idle keys don't pile up
+	if now.Sub(q.sweptAt) >= q.window {
+		for k, w := range q.windows {
+			if !now.Before(w.resetAt) {
+				delete(q.windows, k)
+			}
+		}
+		q.sweptAt = now
+	}
+
+	w, ok := q.windows[key]
+	if !ok || !now.Before(w.resetAt) {
+		w = &rateWindow{resetAt: now.Add(q.window)}
+		q.windows[key] = w
+	}
+	reset := w.resetAt.Sub(now)
+	if w.hits+n > q.max {
+		return q.max - w.hits, reset, false
+	}
+	w.hits += n
+	return q.max - w.hits, reset, true
+}
+
+var (
+	apiQuotaOnce sync.Once
+	apiQuota     *rateQuota
+)
+
+// sharedAPIQuota returns the quota of API_RATE_LIMIT requests per minute
+// shared by every rate-limited route
+func sharedAPIQuota() *rateQuota {
+	apiQuotaOnce.Do(func() {
+		max := defaultAPIRateLimit
+		if v, err := strconv.Atoi(os.Getenv("API_RATE_LIMIT")); err == nil && v > 0 {
+			max = v
+		}
+		apiQuota = newRateQuota(max, time.Minute)
+	})
+	return apiQuota
+}
+
+// chargeAPIQuota charges n requests to the caller's rateLimitKey bucket and
+// sets the X-RateLimit-* headers fiber's limiter sends
+func chargeAPIQuota(c *fiber.Ctx, n int) error {
+	quota := sharedAPIQuota()
+	remaining, reset, ok := quota.take(rateLimitKey(c), n, time.Now())
+	resetSeconds := int(math.Ceil(reset.Seconds()))
+
+	c.Set("X-RateLimit-Limit", strconv.Itoa(quota.max))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	c.Set("X-RateLimit-Reset", strconv.Itoa(resetSeconds))
+	if !ok {
+		return &CustomAPIError{StatusCode: fiber.StatusTooManyRequests, Code: CodeRateLimited, Detail: "Too many requests for this API key", RetryAfter: max(resetSeconds, 1)}
+	}
+	return nil
+}
+
+// apiRateLimiter limits conversion requests to API_RATE_LIMIT per minute,
+// keyed by rateLimitKey. Every instance shares one quota. A request is
+// counted once when it arrives, however long its conversion then runs;
+// batches charge their remaining items themselves.
+func apiRateLimiter() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := chargeAPIQuota(c, 1); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
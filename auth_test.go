@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	apiKeys = map[string]bool{"known": true}
+	trustedAPIKeys = map[string]bool{"trusted": true}
+	defer func() { apiKeys, trustedAPIKeys = nil, nil }()
+
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(rateLimitKey(c))
+	})
+
+	// app.Test requests come from 0.0.0.0
+	tests := []struct {
+		name   string
+		target string
+		header string
+		want   string
+	}{
+		{name: "no key", target: "/", want: "ip:0.0.0.0"},
+		{name: "known header key", target: "/", header: "known", want: "key:known"},
+		{name: "known query key", target: "/?api_key=known", want: "key:known"},
+		{name: "trusted key", target: "/", header: "trusted", want: "key:trusted"},
+		{name: "unknown key", target: "/", header: "made-up", want: "ip:0.0.0.0"},
+		{name: "unknown query key", target: "/?api_key=made-up", want: "ip:0.0.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("rateLimitKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/", requireAPIKey(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	known := map[string]bool{"known": true}
+	tests := []struct {
+		name       string
+		keys       map[string]bool
+		target     string
+		header     string
+		wantStatus int
+		wantDetail string
+	}{
+		{name: "auth off", target: "/", wantStatus: fiber.StatusOK},
+		{name: "valid header key", keys: known, target: "/", header: "known", wantStatus: fiber.StatusOK},
+		{name: "valid query key", keys: known, target: "/?api_key=known", wantStatus: fiber.StatusOK},
+		{name: "trusted key", keys: known, target: "/", header: "trusted", wantStatus: fiber.StatusOK},
+		{name: "invalid key", keys: known, target: "/", header: "made-up", wantStatus: fiber.StatusUnauthorized, wantDetail: "Invalid API key"},
+		{name: "invalid query key", keys: known, target: "/?api_key=made-up", wantStatus: fiber.StatusUnauthorized, wantDetail: "Invalid API key"},
+		{name: "missing key", keys: known, target: "/", wantStatus: fiber.StatusUnauthorized, wantDetail: "Missing API key"},
+		{name: "blank key", keys: known, target: "/", header: "  ", wantStatus: fiber.StatusUnauthorized, wantDetail: "Missing API key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys, trustedAPIKeys = tt.keys, map[string]bool{"trusted": true}
+			defer func() { apiKeys, trustedAPIKeys = nil, nil }()
+
+			req := httptest.NewRequest("GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == fiber.StatusOK {
+				return
+			}
+			var body struct {
+				Code   string `json:"code"`
+				Detail string `json:"detail"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != CodeUnauthorized || body.Detail != tt.wantDetail {
+				t.Errorf("error = %s %q, want %s %q", body.Code, body.Detail, CodeUnauthorized, tt.wantDetail)
+			}
+		})
+	}
+}
+
+// withAPIQuota swaps the shared API quota for a fresh one of max requests
+// per minute for the rest of the test
+func withAPIQuota(t *testing.T, max int) {
+	t.Helper()
+	saved := sharedAPIQuota()
+	apiQuota = newRateQuota(max, time.Minute)
+	t.Cleanup(func() { apiQuota = saved })
+}
+
+func TestAPIRateLimiter(t *testing.T) {
+	withAPIQuota(t, 3)
+
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/convert", apiRateLimiter(), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	tests := []struct {
+		wantStatus    int
+		wantRemaining string
+	}{
+		{wantStatus: 200, wantRemaining: "2"},
+		{wantStatus: 200, wantRemaining: "1"},
+		{wantStatus: 200, wantRemaining: "0"},
+		{wantStatus: 429, wantRemaining: "0"},
+		{wantStatus: 429, wantRemaining: "0"},
+	}
+
+	for i, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", "/convert", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("request %d: status = %d, want %d", i+1, resp.StatusCode, tt.wantStatus)
+		}
+		if got := resp.Header.Get("X-RateLimit-Remaining"); got != tt.wantRemaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %q", i+1, got, tt.wantRemaining)
+		}
+		if tt.wantStatus == 429 {
+			if retryAfter, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter)); err != nil || retryAfter < 1 || retryAfter > 60 {
+				t.Errorf("request %d: Retry-After = %q, want 1-60 seconds", i+1, resp.Header.Get(fiber.HeaderRetryAfter))
+			}
+		}
+	}
+}
+
+func TestRateQuotaTake(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name          string
+		key           string
+		n             int
+		at            time.Duration
+		wantOK        bool
+		wantRemaining int
+	}{
+		{name: "first hit", key: "a", n: 1, wantOK: true, wantRemaining: 4},
+		{name: "several hits at once", key: "a", n: 3, wantOK: true, wantRemaining: 1},
+		{name: "charge over the limit is refused whole", key: "a", n: 2, wantOK: false, wantRemaining: 1},
+		{name: "refused charge was not counted", key: "a", n: 1, wantOK: true, wantRemaining: 0},
+		{name: "other keys have their own window", key: "b", n: 5, wantOK: true, wantRemaining: 0},
+		{name: "window resets", key: "a", n: 1, at: time.Minute, wantOK: true, wantRemaining: 4},
+	}
+
+	quota := newRateQuota(5, time.Minute)
+	for _, tt := range tests {
+		remaining, _, ok := quota.take(tt.key, tt.n, start.Add(tt.at))
+		if ok != tt.wantOK || remaining != tt.wantRemaining {
+			t.Errorf("%s: take(%q, %d) = %d, %v, want %d, %v", tt.name, tt.key, tt.n, remaining, ok, tt.wantRemaining, tt.wantOK)
+		}
+	}
+}
+
+func TestLoadAPIKeyMaxQuality(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    map[string]QualityType
+		wantErr bool
+	}{
+		{name: "unset", value: "", want: map[string]QualityType{}},
+		{name: "pairs", value: "free:SD, paid:HD", want: map[string]QualityType{"free": SD, "paid": HD}},
+		{name: "lower-case quality", value: "free:sd", want: map[string]QualityType{"free": SD}},
+		{name: "unknown quality", value: "free:UHD", wantErr: true},
+		{name: "missing quality", value: "free", wantErr: true},
+		{name: "missing key", value: ":SD", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("API_KEY_MAX_QUALITY", tt.value)
+			got, err := loadAPIKeyMaxQuality()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadAPIKeyMaxQuality() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("loadAPIKeyMaxQuality() = %v, want %v", got, tt.want)
+			}
+			for key, quality := range tt.want {
+				if got[key] != quality {
+					t.Errorf("cap of %q = %q, want %q", key, got[key], quality)
+				}
+			}
+		})
+	}
+}
+
+func TestCapQuality(t *testing.T) {
+	tests := []struct {
+		name        string
+		quality     QualityType
+		opts        ConversionOptions
+		reject      bool
+		wantQuality QualityType
+		wantWidth   int
+		wantNote    bool
+		wantErr     bool
+	}{
+		{name: "no cap", quality: HD, wantQuality: HD},
+		{name: "within cap", quality: SD, opts: ConversionOptions{MaxQuality: SD}, wantQuality: SD},
+		{name: "HD downgraded", quality: HD, opts: ConversionOptions{MaxQuality: SD}, wantQuality: SD, wantNote: true},
+		{name: "wide custom width narrowed", quality: SD, opts: ConversionOptions{MaxQuality: SD, Width: 1024}, wantQuality: SD, wantWidth: 638, wantNote: true},
+		{name: "narrow custom width kept", quality: SD, opts: ConversionOptions{MaxQuality: SD, Width: 320}, wantQuality: SD, wantWidth: 320},
+		{name: "HD rejected", quality: HD, opts: ConversionOptions{MaxQuality: SD}, reject: true, wantErr: true},
+		{name: "within cap in reject mode", quality: SD, opts: ConversionOptions{MaxQuality: SD}, reject: true, wantQuality: SD},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejectOverQuality = tt.reject
+			defer func() { rejectOverQuality = false }()
+
+			quality, opts, note, err := capQuality(tt.quality, tt.opts)
+			if tt.wantErr {
+				var apiErr *CustomAPIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != fiber.StatusForbidden {
+					t.Fatalf("capQuality() error = %v, want a 403", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if quality != tt.wantQuality || opts.Width != tt.wantWidth || (note != "") != tt.wantNote {
+				t.Errorf("capQuality() = %s, width %d, note %q; want %s, width %d, note %v", quality, opts.Width, note, tt.wantQuality, tt.wantWidth, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestQualityCapDowngradesConversion(t *testing.T) {
+	fake := newFakeSlideShare(t, 2)
+	withStorage(t, newMemoryStorage())
+	withConversionCache(t)
+
+	data := convertData(t, fake.deckURL(t), PDF, ConversionOptions{Client: fake.client(), MaxQuality: SD})
+	if data["quality"] != SD || data["width"] != SD.width() {
+		t.Errorf("converted at %v, width %v, want SD", data["quality"], data["width"])
+	}
+	if note, _ := data["quality_note"].(string); note == "" {
+		t.Error("downgraded conversion has no quality_note")
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// defaultBatchConcurrency bounds conversions running for all batches at once when BATCH_CONCURRENCY is unset
+	defaultBatchConcurrency = 3
+	// defaultBatchMaxItems caps one batch when BATCH_MAX_ITEMS is unset
+	defaultBatchMaxItems = 50
+	// defaultBatchTimeout bounds one batch when BATCH_TIMEOUT is unset
+	defaultBatchTimeout = 30 * time.Minute
+)
+
+// batchItem is one entry of the POST /convert/batch body. Empty fields fall
+// back to the request's query params, which set every other option.
+type batchItem struct {
+	URL            string               `json:"url"`
+	ConversionType SlidesConversionType `json:"conversion_type"`
+	Quality        QualityType          `json:"quality"`
+}
+
+var (
+	batchSemOnce sync.Once
+	batchSem     *semaphore.Weighted
+)
+
+// batchSemaphore returns the process-wide limiter shared by every batch, so
+// concurrent batches can't multiply the load on SlideShare
+func batchSemaphore() *semaphore.Weighted {
+	batchSemOnce.Do(func() {
+		limit := int64(defaultBatchConcurrency)
+		if v, err := strconv.ParseInt(os.Getenv("BATCH_CONCURRENCY"), 10, 64); err == nil && v > 0 {
+			limit = v
+		}
+		batchSem = semaphore.NewWeighted(limit)
+	})
+	return batchSem
+}
+
+// batchMaxItems reads the per-batch item cap from BATCH_MAX_ITEMS
+func batchMaxItems() int {
+	if v, err := strconv.Atoi(os.Getenv("BATCH_MAX_ITEMS")); err == nil && v > 0 {
+		return v
+	}
+	return defaultBatchMaxItems
+}
+
+// loadBatchTimeout reads BATCH_TIMEOUT (e.g. "45m"), which replaces
+// REQUEST_TIMEOUT for POST /convert/batch. Items run BATCH_CONCURRENCY at a
+// time across all batches, so a batch needs roughly
+// items / BATCH_CONCURRENCY deck conversions' time; larger workloads belong
+// in POST /jobs.
+func loadBatchTimeout() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("BATCH_TIMEOUT"))
+	if value == "" {
+		return defaultBatchTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid BATCH_TIMEOUT %q: must be a positive duration", value)
+	}
+	return timeout, nil
+}
+
+// convertBatchItem validates and runs one item on top of the shared query params
+func convertBatchItem(ctx context.Context, base ConvertParams, item batchItem, maxQuality QualityType) (map[string]interface{}, error) {
+	params := base
+	params.URL = item.URL
+	params.ID = ""
+	if item.ConversionType != "" {
+		params.ConversionType = item.ConversionType
+	}
+	if item.Quality != "" {
+		params.Quality = item.Quality
+	}
+
+	params.normalize()
+	if err := validateParams(&params); err != nil {
+		return nil, err
+	}
+	opts, err := params.options()
+	if err != nil {
+		return nil, err
+	}
+	opts.MaxQuality = maxQuality
+
+	if err := batchSemaphore().Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer batchSemaphore().Release(1)
+
+	result, err := GetSlidesDownloadLink(ctx, params.URL, params.ConversionType, params.Quality, opts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = &CustomAPIError{StatusCode: fiber.StatusGatewayTimeout, Code: CodeTimeout, Detail: "Batch did not finish within BATCH_TIMEOUT, send fewer items or use POST /jobs"}
+	}
+	return result, err
+}
+
+func batchHandler(c *fiber.Ctx) error {
+	base := new(ConvertParams)
+	if err := c.QueryParser(base); err != nil {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "Invalid query parameters"}
+	}
+	base.normalize()
+	if base.Delivery == DeliveryStream || base.NotifyEmail != "" {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "delivery=stream and notify_email are not supported for batches"}
+	}
+	if base.MaxSlides > 0 && !isTrustedRequest(c) {
+		return &CustomAPIError{StatusCode: fiber.StatusForbidden, Code: CodeForbidden, Detail: "max_slides requires a trusted API key"}
+	}
+
+	var items []batchItem
+	if err := json.Unmarshal(c.Body(), &items); err != nil {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "Body must be a JSON array of {url, conversion_type, quality} items"}
+	}
+	if len(items) == 0 {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "Batch has no items"}
+	}
+	if limit := min(batchMaxItems(), sharedAPIQuota().max); len(items) > limit {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: fmt.Sprintf("Batch supports at most %d items", limit)}
+	}
+
+	// Every item counts against the rate limit, the route already charged one
+	if err := chargeAPIQuota(c, len(items)-1); err != nil {
+		return err
+	}
+
+	// One bad item only fails its own entry
+	results := make([]map[string]interface{}, len(items))
+	ctx := c.UserContext()
+	maxQuality := requestMaxQuality(c)
+	var wg sync.WaitGroup
+	for i, item := range items {
+		wg.Add(1)
+		go func(i int, item batchItem) {
+			defer wg.Done()
+			entry := map[string]interface{}{"index": i, "url": item.URL}
+			result, err := convertBatchItem(ctx, *base, item, maxQuality)
+			if err != nil {
+				entry["success"] = false
+				entry["error"], entry["error_code"] = errorFields(err)
+			} else {
+				entry["success"] = true
+				entry["data"] = result["data"]
+			}
+			results[i] = entry
+		}(i, item)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, entry := range results {
+		if entry["success"] == true {
+			succeeded++
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": fiber.Map{
+			"results":   results,
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+		},
+	})
+}
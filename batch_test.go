@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBatchPartialSuccess(t *testing.T) {
+	fake := newFakeSlideShare(t, 2)
+	app := jobApp(t, fake)
+	withAPIQuota(t, 100)
+	app.Post("/convert/batch", batchHandler)
+	deck := fake.deckURL(t)
+
+	items := []batchItem{
+		{URL: deck},
+		{URL: "https://example.com/not-a-deck"},
+		{URL: deck, ConversionType: "GIF"},
+		{URL: deck, ConversionType: ImagesZip, Quality: SD},
+		{URL: ""},
+	}
+	want := []struct {
+		success bool
+		code    string
+	}{
+		{success: true},
+		{code: CodeInvalidURL},
+		{code: CodeInvalidParams},
+		{success: true},
+		{code: CodeInvalidParams},
+	}
+
+	body, _ := json.Marshal(items)
+	req := httptest.NewRequest("POST", "/convert/batch?conversion_type=PDF&quality=HD", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d for a partly failing batch", resp.StatusCode, fiber.StatusOK)
+	}
+
+	var got struct {
+		Data struct {
+			Results []struct {
+				Index     int                    `json:"index"`
+				Success   bool                   `json:"success"`
+				ErrorCode string                 `json:"error_code"`
+				Data      map[string]interface{} `json:"data"`
+			} `json:"results"`
+			Succeeded int `json:"succeeded"`
+			Failed    int `json:"failed"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Data.Succeeded != 2 || got.Data.Failed != 3 {
+		t.Errorf("succeeded = %d, failed = %d, want 2 and 3", got.Data.Succeeded, got.Data.Failed)
+	}
+	if len(got.Data.Results) != len(items) {
+		t.Fatalf("got %d results for %d items", len(got.Data.Results), len(items))
+	}
+	for i, result := range got.Data.Results {
+		if result.Index != i || result.Success != want[i].success || result.ErrorCode != want[i].code {
+			t.Errorf("item %d: index %d, success %v, error_code %q, want success %v, error_code %q",
+				i, result.Index, result.Success, result.ErrorCode, want[i].success, want[i].code)
+		}
+		if result.Success && result.Data["slides_download_link"] == nil {
+			t.Errorf("item %d succeeded without a download link", i)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// errRemoveUnsupported reports a backend without a way to delete files
+var errRemoveUnsupported = errors.New("storage backend can't delete files")
+
+// purgeCacheHandler serves DELETE /cache?url=..., dropping every cached
+// conversion and the card of a deck so the next request converts it afresh.
+// delete_remote=true also deletes the uploaded files behind them.
+func purgeCacheHandler(c *fiber.Ctx) error {
+	urlStr := c.Query("url")
+	if strings.TrimSpace(urlStr) == "" {
+		return &CustomAPIError{
+			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidURL,
+			Detail:     "Url can't be empty",
+		}
+	}
+	deleteRemote, err := strconv.ParseBool(c.Query("delete_remote", "false"))
+	if err != nil {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "delete_remote must be true or false"}
+	}
+
+	data, err := purgeDeckCache(c.UserContext(), urlStr, deleteRemote)
+	if err != nil {
+		return err
+	}
+
+	return writeResult(c, map[string]interface{}{
+		"success": true,
+		"message": "Cache purged.",
+		"data":    data,
+	})
+}
+
+// purgeDeckCache removes the deck's conversion and card cache entries and,
+// with deleteRemote, their files on whichever backend they were uploaded to.
+// Files that can't be deleted are reported, they don't fail the purge.
+func purgeDeckCache(ctx context.Context, urlStr string, deleteRemote bool) (map[string]interface{}, error) {
+	urlStr, err := NormalizeURL(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	var conversions []CachedConversion
+	if cache := sharedConversionCache(); cache != nil {
+		conversions = cache.Purge(urlStr)
+	}
+	cardPath, cardPurged := purgeCard(urlStr)
+
+	data := map[string]interface{}{
+		"url":                urlStr,
+		"conversions_purged": len(conversions),
+		"card_purged":        cardPurged,
+	}
+	loggerFrom(ctx).Info("cache purged", "url", urlStr, "conversions", len(conversions), "card", cardPurged)
+	if !deleteRemote {
+		return data, nil
+	}
+
+	// Identical outputs of different entries share a path, delete each once
+	files := make(map[string][]string)
+	addFile := func(backend, remotePath string) {
+		if remotePath != "" && !slices.Contains(files[backend], remotePath) {
+			files[backend] = append(files[backend], remotePath)
+		}
+	}
+	for _, conversion := range conversions {
+		for _, remotePath := range conversion.RemotePaths {
+			addFile(conversion.StorageBackend, remotePath)
+		}
+	}
+	if cardPurged {
+		addFile(defaultStorageBackend(), cardPath)
+	}
+
+	deleted := []map[string]interface{}{}
+	failed := []map[string]interface{}{}
+	backends := make([]string, 0, len(files))
+	for backend := range files {
+		backends = append(backends, backend)
+	}
+	slices.Sort(backends)
+	for _, backend := range backends {
+		store, storeErr := getNamedStorage(backend)
+		r, canRemove := store.(remover)
+		for _, remotePath := range files[backend] {
+			err := storeErr
+			if err == nil && !canRemove {
+				err = errRemoveUnsupported
+			}
+			if err == nil {
+				err = r.Remove(ctx, remotePath)
+			}
+			file := map[string]interface{}{"storage_backend": backend, "path": remotePath}
+			if err != nil {
+				loggerFrom(ctx).Warn("failed to delete cached output", "storage_backend", backend, "remote_path", remotePath, "error", err)
+				file["error"] = err.Error()
+				failed = append(failed, file)
+				continue
+			}
+			deleted = append(deleted, file)
+		}
+	}
+	data["remote_files_deleted"] = deleted
+	data["remote_files_failed"] = failed
+	return data, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMemoryConversionCachePurge(t *testing.T) {
+	cache := newMemoryConversionCache(time.Hour, 10)
+	deck := "https://www.slideshare.net/user/deck"
+	cache.Set(conversionCacheKey(deck, PDF, HD, ConversionOptions{}), CachedConversion{DeckSlides: 1})
+	cache.Set(conversionCacheKey(deck, ImagesZip, SD, ConversionOptions{Width: 800}), CachedConversion{DeckSlides: 2})
+	// A deck whose URL extends the purged one is a different deck
+	other := conversionCacheKey(deck+"-2", PDF, HD, ConversionOptions{})
+	cache.Set(other, CachedConversion{DeckSlides: 3})
+
+	if purged := cache.Purge(deck); len(purged) != 2 {
+		t.Fatalf("Purge() removed %d entries, want 2", len(purged))
+	}
+	if _, ok := cache.Get(conversionCacheKey(deck, PDF, HD, ConversionOptions{})); ok {
+		t.Error("purged entry still served")
+	}
+	if _, ok := cache.Get(other); !ok {
+		t.Error("Purge() removed another deck's entry")
+	}
+}
+
+// purgeResponse sends DELETE /cache for deck and decodes the response data
+func purgeResponse(t *testing.T, app *fiber.App, deck, apiKey string, deleteRemote bool) (int, map[string]interface{}) {
+	t.Helper()
+	query := url.Values{"url": {deck}}
+	if deleteRemote {
+		query.Set("delete_remote", "true")
+	}
+	req := httptest.NewRequest("DELETE", "/cache?"+query.Encode(), nil)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body.Data
+}
+
+func purgeApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Delete("/cache", requireTrustedAPIKey(), purgeCacheHandler)
+	return app
+}
+
+func TestPurgeCacheDeletesRemoteFiles(t *testing.T) {
+	fake := newFakeSlideShare(t, 2)
+	withStorage(t, newMemoryStorage())
+	withConversionCache(t)
+	outputDir := t.TempDir()
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("STORAGE_BACKENDS", "local")
+	t.Setenv("OUTPUT_DIR", outputDir)
+	t.Setenv("BASE_URL", "")
+	t.Cleanup(func() {
+		namedStorage.Lock()
+		delete(namedStorage.stores, "local")
+		namedStorage.Unlock()
+	})
+	deck := fake.deckURL(t)
+
+	local := ConversionOptions{Client: fake.client(), StorageBackend: "local", SlideIndex: true}
+	convertData(t, deck, PDF, local)
+	convertData(t, deck, ImagesZip, local)
+	// The memory backend used by default can't delete, its file is reported
+	convertData(t, deck, PDF, ConversionOptions{Client: fake.client()})
+
+	status, data := purgeResponse(t, purgeApp(), deck, "", true)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if data["conversions_purged"] != float64(3) {
+		t.Errorf("conversions_purged = %v, want 3", data["conversions_purged"])
+	}
+	// A PDF, a ZIP and their two slide indexes
+	if deleted, _ := data["remote_files_deleted"].([]interface{}); len(deleted) != 4 {
+		t.Errorf("remote_files_deleted = %v, want 4 files", data["remote_files_deleted"])
+	}
+	failed, _ := data["remote_files_failed"].([]interface{})
+	if len(failed) != 1 || failed[0].(map[string]interface{})["storage_backend"] != "ftp" {
+		t.Errorf("remote_files_failed = %v, want the default backend's PDF", data["remote_files_failed"])
+	}
+
+	var left []string
+	filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			left = append(left, path)
+		}
+		return nil
+	})
+	if len(left) != 0 {
+		t.Errorf("purge left %v in the output dir", left)
+	}
+	if again := convertData(t, deck, PDF, local); again["cached"] != false {
+		t.Error("conversion after the purge was served from cache")
+	}
+}
+
+func TestPurgeCacheNeedsTrustedKey(t *testing.T) {
+	withConversionCache(t)
+	deck := "https://www.slideshare.net/user/deck"
+	tests := []struct {
+		name       string
+		keys       map[string]bool
+		trusted    map[string]bool
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "auth off", wantStatus: fiber.StatusOK},
+		{name: "missing key", keys: map[string]bool{"known": true}, trusted: map[string]bool{"admin": true}, wantStatus: fiber.StatusUnauthorized},
+		{name: "unknown key", keys: map[string]bool{"known": true}, trusted: map[string]bool{"admin": true}, apiKey: "guess", wantStatus: fiber.StatusUnauthorized},
+		{name: "regular key", keys: map[string]bool{"known": true}, trusted: map[string]bool{"admin": true}, apiKey: "known", wantStatus: fiber.StatusForbidden},
+		{name: "trusted key", keys: map[string]bool{"known": true}, trusted: map[string]bool{"admin": true}, apiKey: "admin", wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiKeys, trustedAPIKeys = tt.keys, tt.trusted
+			defer func() { apiKeys, trustedAPIKeys = nil, nil }()
+
+			status, data := purgeResponse(t, purgeApp(), deck, tt.apiKey, false)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status == fiber.StatusOK && data["url"] != deck {
+				t.Errorf("url = %v, want %s", data["url"], deck)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// cardThumbnailWidth matches the common social card width
+	cardThumbnailWidth = 1200
+	// defaultCardCacheTTL applies when CARD_CACHE_TTL is unset
+	defaultCardCacheTTL = 24 * time.Hour
+)
+
+type cardCacheEntry struct {
+	card      map[string]interface{}
+	expiresAt time.Time
+	// remotePath is the thumbnail's path on the default storage backend
+	remotePath string
+}
+
+// cardCache keeps generated cards in memory, keyed by deck URL
+var cardCache = struct {
+	sync.Mutex
+	entries map[string]cardCacheEntry
+}{entries: make(map[string]cardCacheEntry)}
+
+// purgeCard drops the cached card of the normalized deck URL, reporting its
+// thumbnail's remote path and whether a card was cached
+func purgeCard(urlStr string) (remotePath string, ok bool) {
+	cardCache.Lock()
+	defer cardCache.Unlock()
+	entry, ok := cardCache.entries[urlStr]
+	delete(cardCache.entries, urlStr)
+	return entry.remotePath, ok
+}
+
+// cardCacheTTL reads the card cache lifetime from CARD_CACHE_TTL
+func cardCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CARD_CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultCardCacheTTL
+}
+
+// generateThumbnail writes a JPEG copy of srcPath scaled down to width
+func generateThumbnail(srcPath, dstPath string, width int) error {
+	img, err := imaging.Open(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if img.Bounds().Dx() > width {
+		img = imaging.Resize(img, width, 0, imaging.Lanczos)
+	}
+
+	return imaging.Save(img, dstPath, imaging.JPEGQuality(85))
+}
+
+// pickCardSource returns the smallest resolution of a slide that still covers
+// the card width, or the largest one when none does
+func pickCardSource(slide map[int]string) string {
+	return slide[pickResolution(slide, cardThumbnailWidth)]
+}
+
+// GetSlideCard returns deck metadata and a hosted thumbnail of the first slide
+func GetSlideCard(ctx context.Context, urlStr string) (map[string]interface{}, error) {
+	urlStr, err := NormalizeURL(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	cardCache.Lock()
+	entry, ok := cardCache.entries[urlStr]
+	cardCache.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.card, nil
+	}
+
+	docShort, err := docShortFromURL(urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	slidesData, err := FetchSlideImages(ctx, outboundClient, urlStr)
+	if err != nil {
+		return nil, err
+	}
+
+	slides, ok := slidesData["slides"].([]map[int]string)
+	if !ok {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeParseFailed, Detail: "Invalid slides data format"}
+	}
+
+	title, _ := slidesData["title"].(string)
+	author, _ := slidesData["author"].(string)
+	if docShort == "" {
+		docShort = titleSlug(title)
+	}
+	docShort = sanitizeFilename(docShort, "")
+
+	// Only the first slide is downloaded
+	imgPath, err := fetchImage(ctx, outboundClient, pickCardSource(slides[0]), fetchConfig{JPEGQuality: jpegQuality, Timeout: imageTimeout}, nil)
+	var apiErr *CustomAPIError
+	if errors.As(err, &apiErr) {
+		return nil, apiErr
+	}
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeFetchFailed, Detail: fmt.Sprintf("Failed to fetch thumbnail: %v", err)}
+	}
+	defer os.Remove(imgPath)
+
+	tmpThumb, err := os.CreateTemp(tempDir, "slides-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	tmpThumb.Close()
+	defer os.Remove(tmpThumb.Name())
+
+	err = generateThumbnail(imgPath, tmpThumb.Name(), cardThumbnailWidth)
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to generate thumbnail: %v", err)}
+	}
+
+	store, err := getStorage()
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeStorageUnavailable, Detail: fmt.Sprintf("Storage unavailable: %v", err)}
+	}
+
+	// Upload to storage
+	fileName := sanitizeFilename(docShort+"_card", ".jpg")
+	remotePath := buildRemotePath(fileName, ConversionOptions{OutputType: "card", DocShort: docShort})
+	thumbURL, _, err := store.Upload(ctx, tmpThumb.Name(), remotePath)
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+
+	data := map[string]interface{}{
+		"title":       title,
+		"author":      author,
+		"slide_count": len(slides),
+		"thumbnail":   thumbURL,
+		"file_name":   fileName,
+	}
+	now := time.Now()
+	cacheExpiresAt := now.Add(cardCacheTTL())
+	if linkTTL > 0 {
+		signedURL, linkExpiresAt, err := store.SignedURL(remotePath, linkTTL)
+		if err != nil {
+			return nil, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Failed to sign link: %v", err)}
+		}
+		data["thumbnail"] = signedURL
+		if !linkExpiresAt.IsZero() {
+			data["link_expires_at"] = linkExpiresAt.UTC().Format(time.RFC3339)
+			// Like conversions, a cached card is only handed out with at
+			// least half of its link's lifetime left
+			if refresh := linkExpiresAt.Add(-linkTTL / 2); refresh.Before(cacheExpiresAt) {
+				cacheExpiresAt = refresh
+			}
+		}
+	}
+	card := map[string]interface{}{"success": true, "data": data}
+
+	cardCache.Lock()
+	for key, e := range cardCache.entries {
+		if now.After(e.expiresAt) {
+			delete(cardCache.entries, key)
+		}
+	}
+	cardCache.entries[urlStr] = cardCacheEntry{card: card, expiresAt: cacheExpiresAt, remotePath: remotePath}
+	cardCache.Unlock()
+
+	return card, nil
+}
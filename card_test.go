@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetSlideCardSignsThumbnail(t *testing.T) {
+	withLinkTTL(t, time.Hour)
+	tests := []struct {
+		name       string
+		store      Storage
+		wantSigned bool
+	}{
+		{"plain backend", newMemoryStorage(), false},
+		{"signing backend", signingMemoryStorage{newMemoryStorage()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlideShare(t, 2)
+			withStorage(t, tt.store)
+			withOutboundClient(t, fake.client())
+
+			deck := fake.deckURL(t)
+			card, err := GetSlideCard(context.Background(), deck)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				cardCache.Lock()
+				delete(cardCache.entries, deck)
+				cardCache.Unlock()
+			})
+
+			data := card["data"].(map[string]interface{})
+			thumbnail, _ := data["thumbnail"].(string)
+			_, hasExpiry := data["link_expires_at"]
+			if signed := strings.Contains(thumbnail, "?expires="); signed != tt.wantSigned || hasExpiry != tt.wantSigned {
+				t.Errorf("thumbnail = %q, link_expires_at set = %v, want signed %v", thumbnail, hasExpiry, tt.wantSigned)
+			}
+
+			cardCache.Lock()
+			entry, ok := cardCache.entries[deck]
+			cardCache.Unlock()
+			if !ok {
+				t.Fatal("card was not cached")
+			}
+			if cachedUntil := entry.expiresAt; tt.wantSigned && time.Until(cachedUntil) > linkTTL/2 {
+				t.Errorf("card cached until %v, past half of its thumbnail link's lifetime", entry.expiresAt)
+			}
+		})
+	}
+}
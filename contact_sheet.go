@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// defaultSheetColumns and defaultSheetCellWidth apply when the request omits them
+	defaultSheetColumns   = 4
+	defaultSheetCellWidth = 320
+	// sheetGap is the spacing in pixels between and around cells
+	sheetGap = 8
+)
+
+// ConvertURLsToContactSheet composites the slides into a single grid PNG and uploads it to storage
+func ConvertURLsToContactSheet(ctx context.Context, store Storage, imageURLs []string, sheetFilename string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
+	// Download images
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
+	if err != nil {
+		return "", 0, err
+	}
+	defer removeFiles(imagePaths)
+
+	if len(imagePaths) == 0 {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "No images to build a contact sheet from"}
+	}
+
+	columns := opts.SheetColumns
+	if columns <= 0 {
+		columns = defaultSheetColumns
+	}
+	cellWidth := opts.SheetCellWidth
+	if cellWidth <= 0 {
+		cellWidth = defaultSheetCellWidth
+	}
+
+	sheet, err := buildContactSheet(imagePaths, columns, cellWidth)
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to build contact sheet: %v", err)}
+	}
+
+	// Create temp PNG file
+	tmpPNG, err := os.CreateTemp(tempDir, "slides-*.png")
+	if err != nil {
+		return "", 0, err
+	}
+	tmpPNG.Close()
+	defer os.Remove(tmpPNG.Name())
+
+	if err := imaging.Save(sheet, tmpPNG.Name()); err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write contact sheet: %v", err)}
+	}
+
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpPNG.Name(), buildRemotePath(sheetFilename, opts))
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+
+	return downloadURL, size, nil
+}
+
+// buildContactSheet lays the images out in a columns-wide grid. Every cell is
+// cellWidth wide and as tall as the tallest scaled slide; slides are centered
+// in their cell on a white background.
+func buildContactSheet(imagePaths []string, columns, cellWidth int) (image.Image, error) {
+	if columns > len(imagePaths) {
+		columns = len(imagePaths)
+	}
+	rows := (len(imagePaths) + columns - 1) / columns
+
+	thumbs := make([]image.Image, len(imagePaths))
+	cellHeight := 0
+	for i, imgPath := range imagePaths {
+		img, err := imaging.Open(imgPath)
+		if err != nil {
+			return nil, err
+		}
+		thumbs[i] = imaging.Resize(img, cellWidth, 0, imaging.Lanczos)
+		if h := thumbs[i].Bounds().Dy(); h > cellHeight {
+			cellHeight = h
+		}
+	}
+
+	width := columns*cellWidth + (columns+1)*sheetGap
+	height := rows*cellHeight + (rows+1)*sheetGap
+	sheet := imaging.New(width, height, color.White)
+
+	for i, thumb := range thumbs {
+		x := sheetGap + (i%columns)*(cellWidth+sheetGap)
+		y := sheetGap + (i/columns)*(cellHeight+sheetGap) + (cellHeight-thumb.Bounds().Dy())/2
+		sheet = imaging.Paste(sheet, thumb, image.Pt(x, y))
+	}
+	return sheet, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConversionCacheTTL applies when CONVERSION_CACHE_TTL is unset
+	defaultConversionCacheTTL = time.Hour
+	// defaultConversionCacheSize applies when CONVERSION_CACHE_SIZE is unset
+	defaultConversionCacheSize = 500
+)
+
+// ConversionCache remembers finished conversions so identical requests can
+// reuse the uploaded file. Implementations must be safe for concurrent use.
+type ConversionCache interface {
+	Get(key string) (CachedConversion, bool)
+	Set(key string, entry CachedConversion)
+	// Purge removes every entry for the normalized deck URL, whatever its
+	// type, quality or options, and returns them
+	Purge(urlStr string) []CachedConversion
+}
+
+// CachedConversion is what the cache keeps of a finished conversion: the
+// response data plus what a hit needs to answer like a fresh run
+type CachedConversion struct {
+	Data map[string]interface{}
+	// Stats are the original run's stats, returned when a hit asks for stats
+	Stats map[string]interface{}
+	// DeckSlides is the deck's slide count, checked against max_slides
+	DeckSlides int
+	// StorageBackend and RemotePaths locate the uploaded files, so a purge
+	// can delete them
+	StorageBackend string
+	RemotePaths    []string
+}
+
+type memoryCacheEntry struct {
+	entry     CachedConversion
+	expiresAt time.Time
+}
+
+// memoryConversionCache is an in-process ConversionCache with a TTL and a
+// size cap, evicting the entry closest to expiry when full
+type memoryConversionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	entries map[string]memoryCacheEntry
+}
+
+func newMemoryConversionCache(ttl time.Duration, maxSize int) *memoryConversionCache {
+	return &memoryConversionCache{ttl: ttl, maxSize: maxSize, entries: make(map[string]memoryCacheEntry)}
+}
+
+func (c *memoryConversionCache) Get(key string) (CachedConversion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return CachedConversion{}, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return CachedConversion{}, false
+	}
+	return entry.entry, true
+}
+
+func (c *memoryConversionCache) Set(key string, entry CachedConversion) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxSize {
+		var oldestKey string
+		var oldest time.Time
+		for k, e := range c.entries {
+			if oldestKey == "" || e.expiresAt.Before(oldest) {
+				oldestKey, oldest = k, e.expiresAt
+			}
+		}
+		delete(c.entries, oldestKey)
+	}
+
+	c.entries[key] = memoryCacheEntry{entry: entry, expiresAt: now.Add(c.ttl)}
+}
+
+func (c *memoryConversionCache) Purge(urlStr string) []CachedConversion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var purged []CachedConversion
+	for key, e := range c.entries {
+		if strings.HasPrefix(key, urlStr+"|") {
+			purged = append(purged, e.entry)
+			delete(c.entries, key)
+		}
+	}
+	return purged
+}
+
+var (
+	conversionCacheOnce sync.Once
+	conversionCache     ConversionCache
+)
+
+// sharedConversionCache returns the process-wide cache configured from
+// CONVERSION_CACHE_TTL (0 disables caching) and CONVERSION_CACHE_SIZE
+func sharedConversionCache() ConversionCache {
+	conversionCacheOnce.Do(func() {
+		ttl := defaultConversionCacheTTL
+		if value := strings.TrimSpace(os.Getenv("CONVERSION_CACHE_TTL")); value != "" {
+			if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+				ttl = d
+			}
+		}
+		size := defaultConversionCacheSize
+		if v, err := strconv.Atoi(os.Getenv("CONVERSION_CACHE_SIZE")); err == nil && v > 0 {
+			size = v
+		}
+		if ttl > 0 {
+			conversionCache = newMemoryConversionCache(ttl, size)
+		}
+	})
+	return conversionCache
+}
+
+// conversionCacheKey identifies a conversion by its normalized URL, type and
+// quality plus every option that changes the generated file or where it lands
+func conversionCacheKey(urlStr string, conversionType SlidesConversionType, qualityType QualityType, opts ConversionOptions) string {
+	background := ""
+	if opts.PageBackground != nil {
+		background = fmt.Sprintf("%02x%02x%02x", opts.PageBackground.R, opts.PageBackground.G, opts.PageBackground.B)
+	}
+	return strings.Join([]string{
+		urlStr,
+		string(conversionType),
+		string(qualityType),
+		strconv.Itoa(opts.Width),
+		strconv.Itoa(opts.MinWidth),
+		strconv.FormatBool(opts.SlideIndex),
+		strconv.FormatBool(opts.IncludeManifest),
+		opts.PageMode,
+		background,
+		opts.RemoteDir,
+		opts.storageBackend(),
+		opts.ZipLayout,
+		opts.NamePattern,
+		strconv.Itoa(opts.PreviewResolution),
+		strconv.Itoa(opts.MaxDimension),
+		strconv.Itoa(opts.SheetColumns),
+		strconv.Itoa(opts.SheetCellWidth),
+		opts.TIFFCompression,
+		opts.Watermark,
+		strconv.FormatBool(opts.NoWatermark),
+		opts.ImageFormat,
+		opts.SlideSize,
+		strconv.Itoa(opts.From),
+		strconv.Itoa(opts.To),
+	}, "|")
+}
+
+// outputVariant shortens a conversionCacheKey to a path segment. Cached
+// links stay valid because only an identical conversion writes the same path.
+func outputVariant(cacheKey string) string {
+	sum := sha256.Sum256([]byte(cacheKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// linkExpiresSoon reports whether a cached result's signed links have less
+// than half of LINK_TTL left, too little to hand out again
+func linkExpiresSoon(data map[string]interface{}) bool {
+	value, ok := data["link_expires_at"].(string)
+	if !ok {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	return err != nil || time.Until(expiresAt) < linkTTL/2
+}
+
+// copyResultData returns a shallow copy of data without the per-request
+// stats and email_sent fields
+func copyResultData(data map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if key == "stats" || key == "email_sent" {
+			continue
+		}
+		copied[key] = value
+	}
+	return copied
+}
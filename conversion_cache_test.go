@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// convertData runs a conversion and returns its data, failing the test on error
+func convertData(t *testing.T, urlStr string, conversionType SlidesConversionType, opts ConversionOptions) map[string]interface{} {
+	t.Helper()
+	result, err := GetSlidesDownloadLink(context.Background(), urlStr, conversionType, HD, opts)
+	if err != nil {
+		t.Fatalf("GetSlidesDownloadLink() error = %v", err)
+	}
+	return result["data"].(map[string]interface{})
+}
+
+func TestConversionCacheServesSecondIdenticalRequest(t *testing.T) {
+	fake := newFakeSlideShare(t, 3)
+	store := newMemoryStorage()
+	withStorage(t, store)
+	withConversionCache(t)
+	deck := fake.deckURL(t)
+	opts := ConversionOptions{Client: fake.client()}
+
+	first := convertData(t, deck, PDF, opts)
+	pages, images := fake.hits()
+	uploads := store.uploadCount()
+
+	withStats := opts
+	withStats.IncludeStats = true
+	second := convertData(t, deck, PDF, withStats)
+
+	if first["cached"] != false || second["cached"] != true {
+		t.Fatalf("cached = %v then %v, want false then true", first["cached"], second["cached"])
+	}
+	if second["slides_download_link"] != first["slides_download_link"] {
+		t.Errorf("cached link = %v, want %v", second["slides_download_link"], first["slides_download_link"])
+	}
+	if gotPages, gotImages := fake.hits(); gotPages != pages || gotImages != images {
+		t.Errorf("cache hit fetched %d pages and %d images", gotPages-pages, gotImages-images)
+	}
+	if store.uploadCount() != uploads {
+		t.Errorf("cache hit uploaded %d files", store.uploadCount()-uploads)
+	}
+	if _, ok := second["stats"].(map[string]interface{}); !ok {
+		t.Errorf("cache hit dropped the requested stats")
+	}
+}
+
+func TestConversionCacheKeepsEachVariantsFile(t *testing.T) {
+	fake := newFakeSlideShare(t, 4)
+	store := newMemoryStorage()
+	withStorage(t, store)
+	withConversionCache(t)
+	deck := fake.deckURL(t)
+
+	variants := []ConversionOptions{
+		{Client: fake.client()},
+		{Client: fake.client(), From: 2, To: 3},
+		{Client: fake.client(), Watermark: "Draft"},
+		{Client: fake.client(), PageMode: "fit-a4"},
+	}
+
+	paths := make(map[string]bool)
+	contents := make([][]byte, len(variants))
+	for i, opts := range variants {
+		link := convertData(t, deck, PDF, opts)["slides_download_link"].(string)
+		path := strings.TrimPrefix(link, "memory://")
+		if paths[path] {
+			t.Fatalf("variant %d reused the path %s", i, path)
+		}
+		paths[path] = true
+		contents[i], _ = store.file(path)
+	}
+
+	// Every cached link must still lead to the file its own conversion wrote
+	for i, opts := range variants {
+		data := convertData(t, deck, PDF, opts)
+		if data["cached"] != true {
+			t.Fatalf("variant %d: repeat was not served from cache", i)
+		}
+		got, _ := store.file(strings.TrimPrefix(data["slides_download_link"].(string), "memory://"))
+		if !bytes.Equal(got, contents[i]) {
+			t.Errorf("variant %d: cached link points to another conversion's file", i)
+		}
+	}
+}
+
+func TestConversionCacheValidatesBeforeServing(t *testing.T) {
+	fake := newFakeSlideShare(t, 3)
+	withStorage(t, newMemoryStorage())
+	withConversionCache(t)
+	deck := fake.deckURL(t)
+	convertData(t, deck, PDF, ConversionOptions{Client: fake.client()})
+
+	tests := []struct {
+		name       string
+		opts       ConversionOptions
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "deck over max_slides", opts: ConversionOptions{Client: fake.client(), MaxSlides: 2}, wantStatus: 413, wantCode: CodeTooManySlides},
+		{name: "inverted range", opts: ConversionOptions{Client: fake.client(), From: 3, To: 1}, wantStatus: 400, wantCode: CodeInvalidParams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetSlidesDownloadLink(context.Background(), deck, PDF, HD, tt.opts)
+			var apiErr *CustomAPIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus || apiErr.Code != tt.wantCode {
+				t.Fatalf("error = %v, want a %d %s", err, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
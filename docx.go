@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"text/template"
+)
+
+// DOCX pages are A4 landscape with 1 inch margins, in twentieths of a point
+const (
+	docxPageWidthTwips  = 16838
+	docxPageHeightTwips = 11906
+	docxMarginTwips     = 1440
+	// docxEMUPerTwip converts page units to the EMUs used by DrawingML extents
+	docxEMUPerTwip = 635
+)
+
+var docxContentTypesTemplate = template.Must(template.New("types").Parse(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="jpg" ContentType="image/jpeg"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+</Types>`))
+
+var docxRootRelsTemplate = template.Must(template.New("root").Parse(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+</Relationships>`))
+
+var docxDocumentRelsTemplate = template.Must(template.New("rels").Parse(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+{{range .}}<Relationship Id="rId{{.Index}}" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/slide_{{.Index}}.jpg"/>
+{{end}}</Relationships>`))
+
+var docxDocumentTemplate = template.Must(template.New("document").Parse(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture">
+<w:body>
+{{range .Slides}}<w:p><w:pPr><w:jc w:val="center"/></w:pPr>{{if gt .Index 1}}<w:r><w:br w:type="page"/></w:r>{{end}}<w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0"><wp:extent cx="{{.CX}}" cy="{{.CY}}"/><wp:docPr id="{{.Index}}" name="Slide {{.Index}}"/><a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic><pic:nvPicPr><pic:cNvPr id="{{.Index}}" name="slide_{{.Index}}.jpg"/><pic:cNvPicPr/></pic:nvPicPr><pic:blipFill><a:blip r:embed="rId{{.Index}}"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill><pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="{{.CX}}" cy="{{.CY}}"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr></pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r></w:p>
+{{end}}<w:sectPr><w:pgSz w:w="{{.PageWidth}}" w:h="{{.PageHeight}}" w:orient="landscape"/><w:pgMar w:top="{{.Margin}}" w:right="{{.Margin}}" w:bottom="{{.Margin}}" w:left="{{.Margin}}" w:header="0" w:footer="0" w:gutter="0"/></w:sectPr>
+</w:body>
+</w:document>`))
+
+// docxSlide is one embedded slide image, sized in EMUs
+type docxSlide struct {
+	Index  int
+	CX, CY int64
+}
+
+// ConvertURLsToDOCX builds a Word document with one slide image per page and uploads it to storage
+func ConvertURLsToDOCX(ctx context.Context, store Storage, imageURLs []string, docxFilename string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
+	// Download images
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
+	if err != nil {
+		return "", 0, err
+	}
+	defer removeFiles(imagePaths)
+
+	if len(imagePaths) == 0 {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "No images to convert to DOCX"}
+	}
+
+	// Create temp DOCX file
+	tmpDOCX, err := os.CreateTemp(tempDir, "slides-*.docx")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmpDOCX.Name())
+	defer tmpDOCX.Close()
+
+	if err := writeDOCX(tmpDOCX, imagePaths); err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write DOCX: %v", err)}
+	}
+
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpDOCX.Name(), buildRemotePath(docxFilename, opts))
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+
+	return downloadURL, size, nil
+}
+
+// writeDOCX writes a minimal WordprocessingML package embedding each image
+// on its own page, scaled to fit inside the margins without distortion
+func writeDOCX(out *os.File, imagePaths []string) error {
+	maxCX := int64(docxPageWidthTwips-2*docxMarginTwips) * docxEMUPerTwip
+	maxCY := int64(docxPageHeightTwips-2*docxMarginTwips) * docxEMUPerTwip
+
+	slides := make([]docxSlide, len(imagePaths))
+	for i, imgPath := range imagePaths {
+		cfg, err := decodeImageConfig(imgPath)
+		if err != nil {
+			return err
+		}
+		cx, cy := maxCX, maxCX*int64(cfg.Height)/int64(cfg.Width)
+		if cy > maxCY {
+			cx, cy = maxCY*int64(cfg.Width)/int64(cfg.Height), maxCY
+		}
+		slides[i] = docxSlide{Index: i + 1, CX: cx, CY: cy}
+	}
+
+	document := struct {
+		Slides                        []docxSlide
+		PageWidth, PageHeight, Margin int
+	}{slides, docxPageWidthTwips, docxPageHeightTwips, docxMarginTwips}
+
+	zipWriter := zip.NewWriter(out)
+	parts := []struct {
+		name string
+		tmpl *template.Template
+		data interface{}
+	}{
+		{"[Content_Types].xml", docxContentTypesTemplate, nil},
+		{"_rels/.rels", docxRootRelsTemplate, nil},
+		{"word/_rels/document.xml.rels", docxDocumentRelsTemplate, slides},
+		{"word/document.xml", docxDocumentTemplate, document},
+	}
+	for _, part := range parts {
+		entry, err := zipWriter.Create(part.name)
+		if err != nil {
+			zipWriter.Close()
+			return err
+		}
+		if err := part.tmpl.Execute(entry, part.data); err != nil {
+			zipWriter.Close()
+			return err
+		}
+	}
+
+	for _, slide := range slides {
+		if err := addFileToZip(zipWriter, imagePaths[slide.Index-1], fmt.Sprintf("word/media/slide_%d.jpg", slide.Index)); err != nil {
+			zipWriter.Close()
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// docxDrawing is the part of a wp:inline drawing the tests inspect
+type docxDrawing struct {
+	Extent struct {
+		CX int64 `xml:"cx,attr"`
+		CY int64 `xml:"cy,attr"`
+	} `xml:"extent"`
+	Blip struct {
+		Embed string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships embed,attr"`
+	} `xml:"graphic>graphicData>pic>blipFill>blip"`
+}
+
+// docxImageTargets maps each relationship ID in word/_rels/document.xml.rels
+// to the package part it targets
+func docxImageTargets(t *testing.T, files map[string]*zip.File) map[string]string {
+	t.Helper()
+	f, ok := files["word/_rels/document.xml.rels"]
+	if !ok {
+		t.Fatal("docx has no word/_rels/document.xml.rels")
+	}
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.NewDecoder(r).Decode(&rels); err != nil {
+		t.Fatalf("document.xml.rels does not parse: %v", err)
+	}
+	targets := make(map[string]string)
+	for _, rel := range rels.Relationships {
+		targets[rel.ID] = "word/" + rel.Target
+	}
+	return targets
+}
+
+// docxDrawings parses word/document.xml and returns every inline drawing
+func docxDrawings(t *testing.T, files map[string]*zip.File) []docxDrawing {
+	t.Helper()
+	f, ok := files["word/document.xml"]
+	if !ok {
+		t.Fatal("docx has no word/document.xml")
+	}
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var doc struct {
+		Paragraphs []struct {
+			Runs []struct {
+				Drawings []docxDrawing `xml:"drawing>inline"`
+			} `xml:"r"`
+		} `xml:"body>p"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		t.Fatalf("word/document.xml does not parse: %v", err)
+	}
+	var drawings []docxDrawing
+	for _, p := range doc.Paragraphs {
+		for _, run := range p.Runs {
+			drawings = append(drawings, run.Drawings...)
+		}
+	}
+	return drawings
+}
+
+func TestWriteDOCX(t *testing.T) {
+	dir := t.TempDir()
+	imagePaths := []string{
+		writeSlideJPEG(t, dir, 400, 300),
+		writeSlideJPEG(t, dir, 300, 600),
+		writeSlideJPEG(t, dir, 1600, 900),
+	}
+	wantRatios := []float64{400.0 / 300, 300.0 / 600, 1600.0 / 900}
+
+	out, err := os.Create(filepath.Join(dir, "out.docx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDOCX(out, imagePaths); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	zr, err := zip.OpenReader(out.Name())
+	if err != nil {
+		t.Fatalf("docx is not a zip: %v", err)
+	}
+	defer zr.Close()
+	files := make(map[string]*zip.File)
+	var media int
+	for _, f := range zr.File {
+		files[f.Name] = f
+		if strings.HasPrefix(f.Name, "word/media/") {
+			media++
+		}
+	}
+	if media != len(imagePaths) {
+		t.Errorf("docx embeds %d media files, want %d", media, len(imagePaths))
+	}
+
+	drawings := docxDrawings(t, files)
+	if len(drawings) != len(imagePaths) {
+		t.Fatalf("document.xml has %d drawings, want %d", len(drawings), len(imagePaths))
+	}
+	targets := docxImageTargets(t, files)
+	maxCX := int64(docxPageWidthTwips-2*docxMarginTwips) * docxEMUPerTwip
+	maxCY := int64(docxPageHeightTwips-2*docxMarginTwips) * docxEMUPerTwip
+	for i, d := range drawings {
+		if _, ok := files[targets[d.Blip.Embed]]; !ok {
+			t.Errorf("drawing %d embeds %q, which resolves to no media file", i+1, d.Blip.Embed)
+		}
+		if d.Extent.CX <= 0 || d.Extent.CY <= 0 || d.Extent.CX > maxCX || d.Extent.CY > maxCY {
+			t.Errorf("drawing %d is %dx%d EMU, want within %dx%d", i+1, d.Extent.CX, d.Extent.CY, maxCX, maxCY)
+			continue
+		}
+		ratio := float64(d.Extent.CX) / float64(d.Extent.CY)
+		if diff := ratio - wantRatios[i]; diff > 0.01 || diff < -0.01 {
+			t.Errorf("drawing %d has aspect ratio %.3f, want %.3f", i+1, ratio, wantRatios[i])
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+// dryRunAspect estimates slide height from the srcset width, since only
+// widths are known before downloading. Most decks are 16:9.
+const dryRunAspect = 9.0 / 16.0
+
+// dryRunSlide is one selected slide in a dry-run report
+type dryRunSlide struct {
+	Slide      int    `json:"slide"`
+	URL        string `json:"url"`
+	Resolution int    `json:"resolution"`
+}
+
+// dryRunData reports the selected slides, numbered from firstSlide, with
+// their resolutions, an estimate of the total pixels a real run would
+// download and the file it would produce
+func dryRunData(slides []map[int]string, selected []string, firstSlide int, fileName string) map[string]interface{} {
+	resolutions := slideResolutions(slides)
+
+	report := make([]dryRunSlide, len(selected))
+	var pixels int64
+	for i, url := range selected {
+		width := resolutions[url]
+		report[i] = dryRunSlide{Slide: firstSlide + i, URL: url, Resolution: width}
+		pixels += int64(float64(width) * float64(width) * dryRunAspect)
+	}
+
+	return map[string]interface{}{
+		"dry_run":          true,
+		"slide_count":      len(selected),
+		"slides":           report,
+		"estimated_pixels": pixels,
+		"file_name":        fileName,
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// filesHandler serves outputs written by the local storage backend, whether
+// it is the default or one requests may pick. Other backends serve their own
+// files, so the route 404s without it.
+func filesHandler(c *fiber.Ctx) error {
+	notFound := &CustomAPIError{StatusCode: fiber.StatusNotFound, Code: CodeFileNotFound, Detail: "File not found"}
+
+	if !slices.Contains(enabledStorageBackends(), "local") {
+		return notFound
+	}
+	store, err := getNamedStorage("local")
+	if err != nil {
+		return notFound
+	}
+	local, ok := store.(*localStorage)
+	if !ok {
+		return notFound
+	}
+
+	filePath, err := local.resolve(c.Params("*"))
+	if err != nil {
+		return notFound
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		return notFound
+	}
+
+	return c.Download(filePath, filepath.Base(filePath))
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"strconv"
+)
+
+// defaultMaxHTMLSlides caps flipbook size when MAX_HTML_SLIDES is unset
+const defaultMaxHTMLSlides = 200
+
+var flipbookTemplate = template.Must(template.New("flipbook").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{margin:0;background:#222;color:#eee;font-family:sans-serif;display:flex;flex-direction:column;align-items:center;justify-content:center;height:100vh}
+img{max-width:100vw;max-height:88vh;box-shadow:0 0 12px #000}
+nav{margin-top:8px;display:flex;gap:12px;align-items:center}
+button{font-size:16px;padding:4px 14px}
+</style>
+</head>
+<body>
+<img id="slide" src="{{index .Slides 0}}" alt="Slide">
+<nav><button id="prev">&lsaquo;</button><span id="counter"></span><button id="next">&rsaquo;</button></nav>
+<script>
+var slides = {{.Slides}};
+var current = 0;
+function show(i) {
+  current = Math.max(0, Math.min(slides.length - 1, i));
+  document.getElementById("slide").src = slides[current];
+  document.getElementById("counter").textContent = (current + 1) + " / " + slides.length;
+}
+document.getElementById("prev").onclick = function () { show(current - 1); };
+document.getElementById("next").onclick = function () { show(current + 1); };
+document.addEventListener("keydown", function (e) {
+  if (e.key === "ArrowLeft") show(current - 1);
+  if (e.key === "ArrowRight") show(current + 1);
+});
+show(0);
+</script>
+</body>
+</html>
+`))
+
+// maxHTMLSlides reads the flipbook slide cap from MAX_HTML_SLIDES
+func maxHTMLSlides() int {
+	if v, err := strconv.Atoi(os.Getenv("MAX_HTML_SLIDES")); err == nil && v > 0 {
+		return v
+	}
+	return defaultMaxHTMLSlides
+}
+
+// ConvertURLsToHTML builds a zipped HTML flipbook from image URLs and uploads it to storage
+func ConvertURLsToHTML(ctx context.Context, store Storage, imageURLs []string, zipFilename string, title string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
+	if limit := maxHTMLSlides(); len(imageURLs) > limit {
+		return "", 0, &CustomAPIError{StatusCode: 400, Code: CodeTooManySlides, Detail: fmt.Sprintf("HTML flipbook supports at most %d slides", limit)}
+	}
+
+	// Download images
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() {
+		for _, path := range imagePaths {
+			os.Remove(path)
+		}
+	}()
+
+	// Create temp ZIP file
+	tmpZip, err := os.CreateTemp(tempDir, "slides-*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmpZip.Name())
+	defer tmpZip.Close()
+
+	zipWriter := zip.NewWriter(tmpZip)
+
+	// Add slide images
+	slideNames := make([]string, len(imagePaths))
+	for i, imgPath := range imagePaths {
+		slideNames[i] = fmt.Sprintf("slides/slide_%d.jpg", i+1)
+		if err := addFileToZip(zipWriter, imgPath, slideNames[i]); err != nil {
+			zipWriter.Close()
+			return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+		}
+	}
+
+	// Add viewer page
+	indexEntry, err := zipWriter.Create("index.html")
+	if err != nil {
+		zipWriter.Close()
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to create zip entry: %v", err)}
+	}
+	err = flipbookTemplate.Execute(indexEntry, struct {
+		Title  string
+		Slides []string
+	}{Title: title, Slides: slideNames})
+	if err != nil {
+		zipWriter.Close()
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to render flipbook: %v", err)}
+	}
+
+	err = zipWriter.Close()
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to close zip: %v", err)}
+	}
+
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpZip.Name(), buildRemotePath(zipFilename, opts))
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+
+	return downloadURL, size, nil
+}
+
+// addFileToZip copies a local file into a new zip entry
+func addFileToZip(zipWriter *zip.Writer, filePath, entryName string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	zipEntry, err := zipWriter.Create(entryName)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(zipEntry, file)
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ZIP layouts accepted by the zip_layout param
+const (
+	ZipLayoutFlat    = "flat"
+	ZipLayoutGallery = "gallery"
+)
+
+// defaultGalleryThumbWidth applies when GALLERY_THUMB_WIDTH is unset
+const defaultGalleryThumbWidth = 320
+
+// galleryThumbWidth reads the gallery thumbnail width from GALLERY_THUMB_WIDTH
+func galleryThumbWidth() int {
+	if v, err := strconv.Atoi(os.Getenv("GALLERY_THUMB_WIDTH")); err == nil && v > 0 {
+		return v
+	}
+	return defaultGalleryThumbWidth
+}
+
+// galleryEntry describes one slide in the gallery index.json
+type galleryEntry struct {
+	Slide  int    `json:"slide"`
+	Full   string `json:"full"`
+	Thumb  string `json:"thumb"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// generateThumbnails writes a thumbnail for every already-downloaded image.
+// Callers own the returned files and must remove them.
+func generateThumbnails(imagePaths []string, width int) ([]string, error) {
+	thumbPaths := make([]string, 0, len(imagePaths))
+	for _, imgPath := range imagePaths {
+		tmpThumb, err := os.CreateTemp(tempDir, "slide-*.jpg")
+		if err != nil {
+			removeFiles(thumbPaths)
+			return nil, err
+		}
+		tmpThumb.Close()
+		thumbPaths = append(thumbPaths, tmpThumb.Name())
+
+		if err := generateThumbnail(imgPath, tmpThumb.Name(), width); err != nil {
+			removeFiles(thumbPaths)
+			return nil, err
+		}
+	}
+	return thumbPaths, nil
+}
+
+// writeGalleryZip writes a gallery archive to out with full/ and thumbs/
+// folders plus an index.json describing each slide, and manifest when it
+// isn't nil
+func writeGalleryZip(out io.Writer, imagePaths, thumbPaths []string, naming zipNaming, manifest *zipManifest) error {
+	zipWriter := zip.NewWriter(out)
+	index := make([]galleryEntry, len(imagePaths))
+	fullNames := make([]string, len(imagePaths))
+	for i, imgPath := range imagePaths {
+		entry := galleryEntry{
+			Slide: i + 1,
+			Full:  "full/" + naming.name(i, imgPath),
+			Thumb: "thumbs/" + naming.name(i, thumbPaths[i]),
+		}
+		if cfg, err := decodeImageConfig(imgPath); err == nil {
+			entry.Width, entry.Height = cfg.Width, cfg.Height
+		}
+		index[i] = entry
+		fullNames[i] = entry.Full
+
+		if err := addFileToZip(zipWriter, imgPath, entry.Full); err != nil {
+			zipWriter.Close()
+			return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+		}
+		if err := addFileToZip(zipWriter, thumbPaths[i], entry.Thumb); err != nil {
+			zipWriter.Close()
+			return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+		}
+	}
+
+	indexEntry, err := zipWriter.Create("index.json")
+	if err != nil {
+		zipWriter.Close()
+		return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to create zip entry: %v", err)}
+	}
+	if err := json.NewEncoder(indexEntry).Encode(map[string]interface{}{"slides": index}); err != nil {
+		zipWriter.Close()
+		return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+	}
+
+	if err := writeZipManifest(zipWriter, manifest, fullNames); err != nil {
+		zipWriter.Close()
+		return err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("%w: %v", errZipFinalize, err)
+	}
+	return nil
+}
+
+// decodeImageConfig reads the dimensions of a local image file
+func decodeImageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer file.Close()
+
+	cfg, _, err := image.DecodeConfig(file)
+	return cfg, err
+}
+
+// removeFiles deletes temp files, ignoring errors
+func removeFiles(paths []string) {
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
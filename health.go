@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// defaultHealthTimeout bounds the storage probe when HEALTH_TIMEOUT is unset
+	defaultHealthTimeout = 5 * time.Second
+	// healthCacheTTL keeps frequent load balancer probes from hammering storage
+	healthCacheTTL = 5 * time.Second
+)
+
+var healthCache struct {
+	sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// healthTimeout reads the storage probe timeout from HEALTH_TIMEOUT (e.g. "3s")
+func healthTimeout() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("HEALTH_TIMEOUT")); err == nil && v > 0 {
+		return v
+	}
+	return defaultHealthTimeout
+}
+
+// checkStorageHealth probes the storage backend, reusing a recent result
+func checkStorageHealth() error {
+	healthCache.Lock()
+	defer healthCache.Unlock()
+
+	if !healthCache.checkedAt.IsZero() && time.Since(healthCache.checkedAt) < healthCacheTTL {
+		return healthCache.err
+	}
+
+	store, err := getStorage()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), healthTimeout())
+		err = store.Check(ctx)
+		cancel()
+	}
+
+	healthCache.checkedAt = time.Now()
+	healthCache.err = err
+	return err
+}
+
+func healthHandler(c *fiber.Ctx) error {
+	if err := checkStorageHealth(); err != nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"status": "unavailable",
+			"detail": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{"status": "ok"})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// defaultMaxHostConcurrency caps requests per host when MAX_HOST_CONCURRENCY is unset
+const defaultMaxHostConcurrency = 16
+
+// hostLimiter bounds concurrent outbound requests per host across all
+// conversions, covering page scrapes and image fetches alike.
+type hostLimiter struct {
+	mu       sync.Mutex
+	limit    int64
+	sems     map[string]*semaphore.Weighted
+	inFlight map[string]int64
+}
+
+var (
+	hostLimiterOnce sync.Once
+	hostLimits      *hostLimiter
+)
+
+// sharedHostLimiter returns the process-wide per-host limiter
+func sharedHostLimiter() *hostLimiter {
+	hostLimiterOnce.Do(func() {
+		limit := int64(defaultMaxHostConcurrency)
+		if v, err := strconv.ParseInt(os.Getenv("MAX_HOST_CONCURRENCY"), 10, 64); err == nil && v > 0 {
+			limit = v
+		}
+		hostLimits = &hostLimiter{
+			limit:    limit,
+			sems:     make(map[string]*semaphore.Weighted),
+			inFlight: make(map[string]int64),
+		}
+	})
+	return hostLimits
+}
+
+// acquire blocks until a slot for the host of rawURL is free. The returned
+// func must be called to release the slot.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	sem, ok := l.sems[host]
+	if !ok {
+		sem = semaphore.NewWeighted(l.limit)
+		l.sems[host] = sem
+	}
+	l.mu.Unlock()
+
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	l.inFlight[host]++
+	l.mu.Unlock()
+
+	return func() {
+		l.mu.Lock()
+		l.inFlight[host]--
+		l.mu.Unlock()
+		sem.Release(1)
+	}, nil
+}
+
+// snapshot returns the current number of in-flight requests per host
+func (l *hostLimiter) snapshot() map[string]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	current := make(map[string]int64, len(l.inFlight))
+	for host, n := range l.inFlight {
+		current[host] = n
+	}
+	return current
+}
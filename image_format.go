@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// Image formats accepted by the image_format param for IMAGES_ZIP
+const (
+	ImageFormatJPEG = "jpeg"
+	ImageFormatPNG  = "png"
+	ImageFormatWebP = "webp"
+)
+
+// imageFormatExtensions maps each image format to its file extension
+var imageFormatExtensions = map[string]string{
+	ImageFormatJPEG: ".jpg",
+	ImageFormatPNG:  ".png",
+	ImageFormatWebP: ".webp",
+}
+
+// imageFormat is the format slides are encoded in, JPEG unless cfg asks otherwise
+func (c fetchConfig) imageFormat() string {
+	if c.ImageFormat == "" {
+		return ImageFormatJPEG
+	}
+	return c.ImageFormat
+}
+
+// lossless reports whether the image format ignores the encode quality
+func (c fetchConfig) lossless() bool {
+	return c.imageFormat() == ImageFormatPNG
+}
+
+// keepsAlpha reports whether the image format stores transparency, JPEG
+// flattens it
+func (c fetchConfig) keepsAlpha() bool {
+	return c.imageFormat() != ImageFormatJPEG
+}
+
+// encodeImage encodes img into buf in the configured format. JPEG and WebP
+// use the configured quality; PNG is lossless. PNG and WebP encode img
+// directly so its alpha channel survives.
+func (c fetchConfig) encodeImage(buf *bytes.Buffer, img image.Image) error {
+	switch c.imageFormat() {
+	case ImageFormatPNG:
+		return png.Encode(buf, img)
+	case ImageFormatWebP:
+		return webp.Encode(buf, img, &webp.Options{Quality: float32(c.encodeQuality())})
+	default:
+		return jpeg.Encode(buf, imaging.Clone(img), &jpeg.Options{Quality: c.encodeQuality()})
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Job states reported by GET /jobs/:id
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+const (
+	// defaultJobWorkers applies when JOB_WORKERS is unset
+	defaultJobWorkers = 2
+	// jobQueueSize bounds how many jobs may wait before POST /jobs returns 503
+	jobQueueSize = 100
+	// defaultJobTimeout bounds a single background conversion when JOB_TIMEOUT is unset
+	defaultJobTimeout = 10 * time.Minute
+	// jobRetention is how long finished jobs stay pollable
+	jobRetention = time.Hour
+)
+
+// jobRequest is the optional JSON body of POST /jobs
+type jobRequest struct {
+	CallbackURL string `json:"callback_url" validate:"omitempty,http_url"`
+}
+
+// job is one queued conversion and its outcome
+type job struct {
+	id          string
+	params      ConvertParams
+	opts        ConversionOptions
+	callbackURL string
+	requestID   string
+	status      string
+	phase       string
+	progress    int
+	slidesDone  int
+	slidesTotal int
+	result      map[string]interface{}
+	err         error
+	createdAt   time.Time
+	updatedAt   time.Time
+}
+
+// jobStore keeps jobs in memory, keyed by job ID
+var jobStore = struct {
+	sync.Mutex
+	entries map[string]*job
+}{entries: make(map[string]*job)}
+
+var jobQueue = make(chan *job, jobQueueSize)
+
+// jobWorkers tracks running workers and pending webhook deliveries so
+// shutdown can wait for them
+var (
+	jobWorkers  sync.WaitGroup
+	jobWebhooks sync.WaitGroup
+)
+
+// jobIntake guards closing jobQueue against concurrent enqueues
+var jobIntake = struct {
+	sync.Mutex
+	closed bool
+}{}
+
+// jobsCtx parents every job's context and is cancelled when shutdown gives up waiting
+var jobsCtx, cancelJobs = context.WithCancel(context.Background())
+
+// errShuttingDown fails jobs that were still queued when shutdown started
+var errShuttingDown = &CustomAPIError{StatusCode: fiber.StatusServiceUnavailable, Code: CodeInternal, Detail: "Server is shutting down"}
+
+// jobTimeout reads the per-job conversion deadline from JOB_TIMEOUT (e.g. "5m")
+func jobTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("JOB_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultJobTimeout
+}
+
+// startJobWorkers launches JOB_WORKERS goroutines draining the job queue
+func startJobWorkers() {
+	workers := defaultJobWorkers
+	if v, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && v > 0 {
+		workers = v
+	}
+	for i := 0; i < workers; i++ {
+		jobWorkers.Add(1)
+		go func() {
+			defer jobWorkers.Done()
+			for j := range jobQueue {
+				runJob(j)
+			}
+		}()
+	}
+}
+
+// stopJobWorkers stops accepting jobs, fails the ones still queued and waits
+// for running jobs and their webhooks until ctx expires, then cancels them
+func stopJobWorkers(ctx context.Context) error {
+	jobIntake.Lock()
+	if !jobIntake.closed {
+		jobIntake.closed = true
+		close(jobQueue)
+	}
+	jobIntake.Unlock()
+
+	// Jobs nobody started yet would only delay shutdown
+	for j := range jobQueue {
+		setJobStatus(j, JobFailed, nil, errShuttingDown)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		jobWorkers.Wait()
+		jobWebhooks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancelJobs()
+		return ctx.Err()
+	}
+}
+
+// runJob performs the conversion and records its result
+func runJob(j *job) {
+	setJobStatus(j, JobRunning, nil, nil)
+
+	jobCtx := withJobID(withRequestID(jobsCtx, j.requestID), j.id)
+	ctx, cancel := context.WithTimeout(jobCtx, jobTimeout())
+	defer cancel()
+	logger := loggerFrom(ctx)
+	logger.Info("job started")
+
+	opts := j.opts
+	opts.Progress = func(phase string, done, total int) {
+		setJobProgress(j, phase, done, total)
+	}
+	result, err := GetSlidesDownloadLink(ctx, j.params.URL, j.params.ConversionType, j.params.Quality, opts)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = &CustomAPIError{StatusCode: fiber.StatusGatewayTimeout, Code: CodeTimeout, Detail: fmt.Sprintf("Job did not finish within %s", jobTimeout())}
+	}
+	if err != nil {
+		logger.Error("job failed", "error", err)
+		setJobStatus(j, JobFailed, nil, err)
+	} else {
+		logger.Info("job done")
+		setJobStatus(j, JobDone, result, nil)
+	}
+
+	// Deliveries retry with backoff, so they must not hold up the worker
+	if j.callbackURL != "" {
+		jobStore.Lock()
+		payload := map[string]interface{}{"success": err == nil, "data": jobView(j)}
+		jobStore.Unlock()
+		jobWebhooks.Add(1)
+		go func() {
+			defer jobWebhooks.Done()
+			deliverWebhook(jobCtx, j.callbackURL, payload)
+		}()
+	}
+}
+
+func setJobStatus(j *job, status string, result map[string]interface{}, err error) {
+	jobStore.Lock()
+	defer jobStore.Unlock()
+	j.status = status
+	j.result = result
+	j.err = err
+	if status == JobDone {
+		j.progress = 100
+	}
+	j.updatedAt = time.Now()
+}
+
+// setJobProgress records a progress report. Reports from concurrent
+// downloads can arrive out of order, so progress never moves backwards.
+func setJobProgress(j *job, phase string, done, total int) {
+	jobStore.Lock()
+	defer jobStore.Unlock()
+	percent := progressPercent(phase, done, total)
+	if percent < j.progress || j.status != JobRunning {
+		return
+	}
+	j.phase = phase
+	j.progress = percent
+	j.slidesDone = max(j.slidesDone, done)
+	j.slidesTotal = total
+	j.updatedAt = time.Now()
+}
+
+// newJobID returns a random 128-bit hex ID
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// enqueueJob stores a new queued job and hands it to the workers. The job
+// logs under the request ID found in ctx.
+func enqueueJob(ctx context.Context, params ConvertParams, opts ConversionOptions, callbackURL string) (*job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	j := &job{id: id, params: params, opts: opts, callbackURL: callbackURL, requestID: requestIDFrom(ctx), status: JobQueued, createdAt: now, updatedAt: now}
+
+	jobStore.Lock()
+	for key, e := range jobStore.entries {
+		if (e.status == JobDone || e.status == JobFailed) && now.Sub(e.updatedAt) > jobRetention {
+			delete(jobStore.entries, key)
+		}
+	}
+	jobStore.entries[id] = j
+	jobStore.Unlock()
+
+	jobIntake.Lock()
+	defer jobIntake.Unlock()
+	if !jobIntake.closed {
+		select {
+		case jobQueue <- j:
+			return j, nil
+		default:
+		}
+	}
+
+	jobStore.Lock()
+	delete(jobStore.entries, id)
+	jobStore.Unlock()
+	if jobIntake.closed {
+		return nil, errShuttingDown
+	}
+	return nil, &CustomAPIError{StatusCode: fiber.StatusServiceUnavailable, Code: CodeQueueFull, Detail: "Job queue is full, try again later", RetryAfter: 30}
+}
+
+// jobView renders a job for GET /jobs/:id. Callers must hold jobStore.
+func jobView(j *job) map[string]interface{} {
+	view := map[string]interface{}{
+		"job_id":     j.id,
+		"status":     j.status,
+		"progress":   j.progress,
+		"created_at": j.createdAt.UTC().Format(time.RFC3339),
+		"updated_at": j.updatedAt.UTC().Format(time.RFC3339),
+	}
+	if j.status == JobRunning && j.phase != "" {
+		view["phase"] = j.phase
+		view["slides_done"] = j.slidesDone
+		view["slides_total"] = j.slidesTotal
+	}
+	if j.status == JobDone {
+		view["result"] = j.result["data"]
+	}
+	if j.status == JobFailed {
+		view["error"], view["error_code"] = errorFields(j.err)
+	}
+	return view
+}
+
+func createJobHandler(c *fiber.Ctx) error {
+	params, opts, err := parseConvertParams(c)
+	if err != nil {
+		return err
+	}
+	if params.Delivery == DeliveryStream {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "delivery=stream is not supported for jobs"}
+	}
+
+	body := new(jobRequest)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(body); err != nil {
+			return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "Invalid request body"}
+		}
+	}
+	if err := validateParams(body); err != nil {
+		return err
+	}
+	if body.CallbackURL != "" {
+		if err := checkCallbackURL(c.UserContext(), body.CallbackURL); err != nil {
+			return err
+		}
+	}
+
+	j, err := enqueueJob(c.UserContext(), *params, opts, body.CallbackURL)
+	if err != nil {
+		return err
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"success": true,
+		"message": "Job queued.",
+		"data": fiber.Map{
+			"job_id": j.id,
+			"status": JobQueued,
+		},
+	})
+}
+
+func getJobHandler(c *fiber.Ctx) error {
+	jobStore.Lock()
+	j, ok := jobStore.entries[c.Params("id")]
+	var view map[string]interface{}
+	if ok {
+		view = jobView(j)
+	}
+	jobStore.Unlock()
+
+	if !ok {
+		return &CustomAPIError{StatusCode: fiber.StatusNotFound, Code: CodeJobNotFound, Detail: "Job not found"}
+	}
+
+	return writeResult(c, map[string]interface{}{
+		"success": true,
+		"data":    view,
+	})
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// jobApp serves the job endpoints for conversions of fake's decks
+func jobApp(t *testing.T, fake *fakeSlideShare) *fiber.App {
+	t.Helper()
+	validate = newValidator()
+	withStorage(t, newMemoryStorage())
+	withConversionCache(t)
+	withOutboundClient(t, fake.client())
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Post("/jobs", createJobHandler)
+	app.Get("/jobs/:id", getJobHandler)
+	return app
+}
+
+// runQueuedJobs works through the next n queued jobs in the background, in
+// place of startJobWorkers whose workers would outlive the test
+func runQueuedJobs(t *testing.T, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			runJob(<-jobQueue)
+		}
+	}()
+	t.Cleanup(wg.Wait)
+}
+
+// submitJob posts a job for deck and returns its ID
+func submitJob(t *testing.T, app *fiber.App, deck string, conversionType SlidesConversionType) string {
+	t.Helper()
+	query := url.Values{"url": {deck}, "conversion_type": {string(conversionType)}, "quality": {string(HD)}}
+	resp, err := app.Test(httptest.NewRequest("POST", "/jobs?"+query.Encode(), nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("POST /jobs status = %d, want %d", resp.StatusCode, fiber.StatusAccepted)
+	}
+	var body struct {
+		Data struct {
+			JobID  string `json:"job_id"`
+			Status string `json:"status"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.JobID == "" || body.Data.Status != JobQueued {
+		t.Fatalf("POST /jobs returned job %q in state %q, want a queued job", body.Data.JobID, body.Data.Status)
+	}
+	t.Cleanup(func() {
+		jobStore.Lock()
+		delete(jobStore.entries, body.Data.JobID)
+		jobStore.Unlock()
+	})
+	return body.Data.JobID
+}
+
+// getJob polls GET /jobs/:id once
+func getJob(t *testing.T, app *fiber.App, id string) map[string]interface{} {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", "/jobs/"+id, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET /jobs/%s status = %d, want %d", id, resp.StatusCode, fiber.StatusOK)
+	}
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Data
+}
+
+// pollJob polls the job until it has finished and returns its final view
+func pollJob(t *testing.T, app *fiber.App, id string) map[string]interface{} {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		view := getJob(t, app, id)
+		if view["status"] == JobDone || view["status"] == JobFailed {
+			return view
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %v after 10s", view["status"])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	tests := []struct {
+		name       string
+		slides     int
+		wantStatus string
+		wantCode   string
+	}{
+		{name: "converts the deck", slides: 2, wantStatus: JobDone},
+		{name: "reports a failed conversion", slides: 0, wantStatus: JobFailed, wantCode: CodeNoSlidesFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlideShare(t, tt.slides)
+			app := jobApp(t, fake)
+
+			id := submitJob(t, app, fake.deckURL(t), PDF)
+			// Nothing runs jobs until the worker starts
+			if view := getJob(t, app, id); view["status"] != JobQueued {
+				t.Fatalf("status before any worker = %v, want %s", view["status"], JobQueued)
+			}
+			runQueuedJobs(t, 1)
+
+			view := pollJob(t, app, id)
+			if view["status"] != tt.wantStatus {
+				t.Fatalf("status = %v (error %v), want %s", view["status"], view["error"], tt.wantStatus)
+			}
+			if tt.wantStatus == JobFailed {
+				if view["error_code"] != tt.wantCode {
+					t.Errorf("error_code = %v, want %s", view["error_code"], tt.wantCode)
+				}
+				return
+			}
+			result, _ := view["result"].(map[string]interface{})
+			if link, _ := result["slides_download_link"].(string); link == "" {
+				t.Errorf("finished job has no download link: %v", view)
+			}
+			if result["size"] == float64(0) || view["progress"] != float64(100) {
+				t.Errorf("finished job reports size %v and progress %v", result["size"], view["progress"])
+			}
+		})
+	}
+}
+
+func TestJobProgressIncreases(t *testing.T) {
+	const slides = 4
+	fake := newFakeSlideShare(t, slides)
+	// Each download waits for the test to let one image through
+	gate := make(chan struct{})
+	fake.serveImage = func(w http.ResponseWriter, r *http.Request, n int) {
+		select {
+		case <-gate:
+		case <-time.After(10 * time.Second):
+		}
+		w.Write(slideJPEG(n))
+	}
+	app := jobApp(t, fake)
+	id := submitJob(t, app, fake.deckURL(t), PDF)
+	runQueuedJobs(t, 1)
+
+	var seen []float64
+	record := func(view map[string]interface{}) {
+		progress, _ := view["progress"].(float64)
+		if len(seen) == 0 || progress != seen[len(seen)-1] {
+			seen = append(seen, progress)
+		}
+	}
+	for released := 1; released <= slides; released++ {
+		gate <- struct{}{}
+		// Wait for the job to count the released image
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			view := getJob(t, app, id)
+			record(view)
+			if done, _ := view["slides_done"].(float64); int(done) >= released || view["status"] == JobDone {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("job never reported slide %d as downloaded: %v", released, view)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	final := pollJob(t, app, id)
+	record(final)
+
+	if final["status"] != JobDone {
+		t.Fatalf("status = %v (error %v), want %s", final["status"], final["error"], JobDone)
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i] < seen[i-1] {
+			t.Fatalf("progress went backwards: %v", seen)
+		}
+	}
+	// One step per downloaded slide at least, ending at 100
+	if len(seen) < slides || seen[len(seen)-1] != 100 {
+		t.Errorf("progress moved through %v, want a step per slide ending at 100", seen)
+	}
+}
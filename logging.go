@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// requestIDHeader carries the correlation ID in and out of every request
+const requestIDHeader = "X-Request-ID"
+
+type (
+	requestIDKey struct{}
+	jobIDKey     struct{}
+)
+
+// newLogger builds the JSON logger used for everything, including the
+// standard log package, at the level named by LOG_LEVEL (debug, info, warn, error)
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(os.Getenv("LOG_LEVEL")))); err != nil {
+		level = slog.LevelInfo
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level}))
+}
+
+// withRequestID returns ctx carrying the request's correlation ID
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the correlation ID stored in ctx, if any
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// withJobID returns ctx carrying the ID of the async job it runs
+func withJobID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, jobIDKey{}, id)
+}
+
+// loggerFrom returns the default logger tagged with ctx's request and job IDs
+func loggerFrom(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id := requestIDFrom(ctx); id != "" {
+		logger = logger.With("request_id", id)
+	}
+	if id, _ := ctx.Value(jobIDKey{}).(string); id != "" {
+		logger = logger.With("job_id", id)
+	}
+	return logger
+}
+
+// responseStatus is the status a request will be answered with. The error
+// handler has not written it yet when middleware sees the handler's error.
+func responseStatus(c *fiber.Ctx, err error) int {
+	var apiErr *CustomAPIError
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.StatusCode
+	case errors.As(err, &fiberErr):
+		return fiberErr.Code
+	case err != nil:
+		return fiber.StatusInternalServerError
+	default:
+		return c.Response().StatusCode()
+	}
+}
+
+// requestLogger reuses an incoming X-Request-ID or generates one, echoes it
+// in the response, stores it in the user context for loggerFrom and logs
+// every request when it completes
+func requestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := strings.TrimSpace(c.Get(requestIDHeader))
+		if id == "" || len(id) > 128 {
+			id = utils.UUIDv4()
+		}
+		c.Set(requestIDHeader, id)
+		c.SetUserContext(withRequestID(c.UserContext(), id))
+
+		start := time.Now()
+		err := c.Next()
+
+		status := responseStatus(c, err)
+		httpRequestsTotal.WithLabelValues(c.Route().Path, strconv.Itoa(status)).Inc()
+
+		logger := loggerFrom(c.UserContext())
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+		}
+		if status >= fiber.StatusInternalServerError {
+			logger.Error("request failed", attrs...)
+		} else {
+			logger.Info("request completed", attrs...)
+		}
+		return err
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gofiber/fiber/v2"
+)
+
+// captureLogs points the default logger at a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// logRecords decodes every JSON line written to buf
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRequestLoggerTagsLogsWithRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"incoming ID is reused", "req-123"},
+		{"missing ID is generated", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			app := fiber.New()
+			app.Use(requestLogger())
+			app.Get("/", func(c *fiber.Ctx) error {
+				loggerFrom(c.UserContext()).Info("handling")
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id := resp.Header.Get(requestIDHeader)
+			if id == "" || (tt.header != "" && id != tt.header) {
+				t.Fatalf("%s = %q, want %q", requestIDHeader, id, tt.header)
+			}
+
+			records := logRecords(t, logs)
+			if len(records) != 2 {
+				t.Fatalf("got %d log records, want the handler's and the access log", len(records))
+			}
+			for _, record := range records {
+				if record["request_id"] != id {
+					t.Errorf("%q logged request_id %v, want %q", record["msg"], record["request_id"], id)
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineLogsCarryRequestAndJobID(t *testing.T) {
+	tests := []struct {
+		name  string
+		jobID string
+		log   func(ctx context.Context)
+	}{
+		{"srcset parsing", "", func(ctx context.Context) {
+			doc, _ := goquery.NewDocumentFromReader(strings.NewReader(
+				`<img data-testid="vertical-slide-image" srcset="https://image.slidesharecdn.com/a.jpg 638w, https://image.slidesharecdn.com/b.jpg 638w">`))
+			extractSlideImages(ctx, doc, "https://www.slideshare.net/tester/deck")
+		}},
+		{"webhook delivery", "job-7", func(ctx context.Context) {
+			deliverWebhook(ctx, "https://hooks.example.com/done", map[string]any{"success": true})
+		}},
+	}
+	t.Setenv("WEBHOOK_SECRET", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+			ctx := withRequestID(context.Background(), "req-42")
+			if tt.jobID != "" {
+				ctx = withJobID(ctx, tt.jobID)
+			}
+			tt.log(ctx)
+
+			records := logRecords(t, logs)
+			if len(records) == 0 {
+				t.Fatal("nothing was logged")
+			}
+			for _, record := range records {
+				if record["request_id"] != "req-42" {
+					t.Errorf("%q logged request_id %v, want req-42", record["msg"], record["request_id"])
+				}
+				if tt.jobID != "" && record["job_id"] != tt.jobID {
+					t.Errorf("%q logged job_id %v, want %s", record["msg"], record["job_id"], tt.jobID)
+				}
+			}
+		})
+	}
+}
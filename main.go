@@ -1,10 +1,21 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 )
@@ -12,9 +23,37 @@ import (
 // Custom error type
 type CustomAPIError struct {
 	StatusCode int    `json:"-"`
+	Code       string `json:"code"` // machine-readable, one of the Code* constants
 	Detail     string `json:"detail"`
+	RetryAfter int    `json:"-"` // seconds, sent as the Retry-After header when set
 }
 
+// Error codes returned in the "code" field of error responses
+const (
+	CodeInvalidURL         = "INVALID_URL"
+	CodeInvalidParams      = "INVALID_PARAMS"
+	CodeHostNotAllowed     = "HOST_NOT_ALLOWED"
+	CodeDeckNotFound       = "DECK_NOT_FOUND"
+	CodeNoSlidesFound      = "NO_SLIDES_FOUND"
+	CodeSlidesFiltered     = "SLIDES_FILTERED"
+	CodeResolutionTooLow   = "RESOLUTION_TOO_LOW"
+	CodeTooManySlides      = "TOO_MANY_SLIDES"
+	CodeFetchFailed        = "FETCH_FAILED"
+	CodeParseFailed        = "PARSE_FAILED"
+	CodeConversionFailed   = "CONVERSION_FAILED"
+	CodeStorageUnavailable = "STORAGE_UNAVAILABLE"
+	CodeUploadFailed       = "UPLOAD_FAILED"
+	CodeRateLimited        = "RATE_LIMITED"
+	CodeQueueFull          = "QUEUE_FULL"
+	CodeJobNotFound        = "JOB_NOT_FOUND"
+	CodeFileNotFound       = "FILE_NOT_FOUND"
+	CodeTimeout            = "TIMEOUT"
+	CodeConfigError        = "CONFIG_ERROR"
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeForbidden          = "FORBIDDEN"
+	CodeInternal           = "INTERNAL_ERROR"
+)
+
 func (e *CustomAPIError) Error() string {
 	return e.Detail
 }
@@ -23,9 +62,14 @@ func (e *CustomAPIError) Error() string {
 type SlidesConversionType string
 
 const (
-	PDF       SlidesConversionType = "PDF"
-	PPTX      SlidesConversionType = "PPTX"
-	ImagesZip SlidesConversionType = "IMAGES_ZIP"
+	PDF          SlidesConversionType = "PDF"
+	PPTX         SlidesConversionType = "PPTX"
+	ImagesZip    SlidesConversionType = "IMAGES_ZIP"
+	HTML         SlidesConversionType = "HTML"
+	JSON         SlidesConversionType = "JSON"
+	ContactSheet SlidesConversionType = "CONTACT_SHEET"
+	DOCX         SlidesConversionType = "DOCX"
+	TIFF         SlidesConversionType = "TIFF"
 )
 
 type QualityType string
@@ -35,28 +79,418 @@ const (
 	SD QualityType = "SD"
 )
 
+// width returns the target srcset width a quality preset maps to
+func (q QualityType) width() int {
+	if q == SD {
+		return 638
+	}
+	return 2048
+}
+
+// capQuality holds a conversion to opts.MaxQuality. A higher quality or wider
+// custom width is lowered to the cap, with a note for the response, or
+// refused when QUALITY_CAP_MODE is reject.
+func capQuality(quality QualityType, opts ConversionOptions) (QualityType, ConversionOptions, string, error) {
+	maxQuality := opts.MaxQuality
+	if maxQuality == "" || (maxQuality.width() >= quality.width() && opts.Width <= maxQuality.width()) {
+		return quality, opts, "", nil
+	}
+
+	requested := string(quality)
+	if opts.Width > maxQuality.width() {
+		requested = fmt.Sprintf("width %d", opts.Width)
+	}
+	if rejectOverQuality {
+		return "", opts, "", &CustomAPIError{
+			StatusCode: fiber.StatusForbidden,
+			Code:       CodeForbidden,
+			Detail:     fmt.Sprintf("This API key is limited to %s quality, %s is not allowed", maxQuality, requested),
+		}
+	}
+	if opts.Width > maxQuality.width() {
+		opts.Width = maxQuality.width()
+	}
+	if maxQuality.width() < quality.width() {
+		quality = maxQuality
+	}
+	return quality, opts, fmt.Sprintf("This API key is limited to %s quality, %s was converted at %s", maxQuality, requested, maxQuality), nil
+}
+
+// validate checks request params against their validate tags, created in main
+var validate *validator.Validate
+
+// newValidator reports field errors using their query param or JSON field names
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		if name := strings.Split(field.Tag.Get("query"), ",")[0]; name != "" {
+			return name
+		}
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+		return field.Name
+	})
+	return v
+}
+
+// defaultQuality is applied when a request omits quality, set from DEFAULT_QUALITY
+var defaultQuality = HD
+
+// defaultMinWidth is applied when a request omits min_width, set from MIN_WIDTH
+var defaultMinWidth int
+
+// loadDefaultMinWidth parses MIN_WIDTH, where unset or 0 disables the guard
+func loadDefaultMinWidth() (int, error) {
+	value := strings.TrimSpace(os.Getenv("MIN_WIDTH"))
+	if value == "" {
+		return 0, nil
+	}
+	width, err := strconv.Atoi(value)
+	if err != nil || width < 0 {
+		return 0, fmt.Errorf("invalid MIN_WIDTH %q: must be a non-negative integer", value)
+	}
+	return width, nil
+}
+
+// maxConcurrency bounds parallel image downloads per conversion, set from MAX_CONCURRENCY
+var maxConcurrency int64 = DefaultMaxConcurrency
+
+// loadMaxConcurrency parses MAX_CONCURRENCY, falling back to DefaultMaxConcurrency
+func loadMaxConcurrency() (int64, error) {
+	value := strings.TrimSpace(os.Getenv("MAX_CONCURRENCY"))
+	if value == "" {
+		return DefaultMaxConcurrency, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid MAX_CONCURRENCY %q: must be a positive integer", value)
+	}
+	return n, nil
+}
+
+// jpegQuality forces re-encoding slide images at this quality, set from
+// JPEG_QUALITY. Zero passes JPEG slides through unchanged.
+var jpegQuality int
+
+// loadJPEGQuality parses JPEG_QUALITY, where unset keeps source JPEGs as served
+func loadJPEGQuality() (int, error) {
+	value := strings.TrimSpace(os.Getenv("JPEG_QUALITY"))
+	if value == "" {
+		return 0, nil
+	}
+	quality, err := strconv.Atoi(value)
+	if err != nil || quality < 1 || quality > 100 {
+		return 0, fmt.Errorf("invalid JPEG_QUALITY %q: must be an integer from 1 to 100", value)
+	}
+	return quality, nil
+}
+
+// DefaultMaxSlides caps how many slides one conversion downloads when MAX_SLIDES is unset
+const DefaultMaxSlides = 500
+
+// maxSlides is the per-conversion slide cap, set from MAX_SLIDES
+var maxSlides = DefaultMaxSlides
+
+// loadMaxSlides parses MAX_SLIDES, falling back to DefaultMaxSlides
+func loadMaxSlides() (int, error) {
+	value := strings.TrimSpace(os.Getenv("MAX_SLIDES"))
+	if value == "" {
+		return DefaultMaxSlides, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid MAX_SLIDES %q: must be a positive integer", value)
+	}
+	return limit, nil
+}
+
+// pathTemplate lays out remote output paths, set from PATH_TEMPLATE
+var pathTemplate = DefaultPathTemplate
+
+// loadPathTemplate parses PATH_TEMPLATE, falling back to DefaultPathTemplate
+func loadPathTemplate() (string, error) {
+	value := strings.TrimSpace(os.Getenv("PATH_TEMPLATE"))
+	if value == "" {
+		return DefaultPathTemplate, nil
+	}
+	if err := validatePathTemplate(value); err != nil {
+		return "", fmt.Errorf("invalid PATH_TEMPLATE %q: %v", value, err)
+	}
+	return value, nil
+}
+
+// DefaultMaxImageBytes caps one downloaded slide when MAX_IMAGE_BYTES is unset
+const DefaultMaxImageBytes = 50 << 20
+
+// maxImageBytes is the largest response body read from SlideShare or its
+// CDNs, set from MAX_IMAGE_BYTES
+var maxImageBytes = DefaultMaxImageBytes
+
+// loadMaxImageBytes parses MAX_IMAGE_BYTES, falling back to DefaultMaxImageBytes
+func loadMaxImageBytes() (int, error) {
+	value := strings.TrimSpace(os.Getenv("MAX_IMAGE_BYTES"))
+	if value == "" {
+		return DefaultMaxImageBytes, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("invalid MAX_IMAGE_BYTES %q: must be a positive integer", value)
+	}
+	return limit, nil
+}
+
+// DefaultImageTimeout bounds one slide download attempt when IMAGE_TIMEOUT is unset
+const DefaultImageTimeout = 20 * time.Second
+
+// imageTimeout is the per-attempt slide download timeout, set from IMAGE_TIMEOUT
+var imageTimeout = DefaultImageTimeout
+
+// loadImageTimeout parses IMAGE_TIMEOUT as a Go duration (e.g. "45s")
+func loadImageTimeout() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("IMAGE_TIMEOUT"))
+	if value == "" {
+		return DefaultImageTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid IMAGE_TIMEOUT %q: must be a positive duration", value)
+	}
+	return timeout, nil
+}
+
+// maxLinkTTL is the longest lifetime S3 and GCS V4 signatures allow
+const maxLinkTTL = 7 * 24 * time.Hour
+
+// linkTTL makes backends that can sign return links valid this long, set
+// from LINK_TTL. Zero keeps plain public links.
+var linkTTL time.Duration
+
+// loadLinkTTL parses LINK_TTL as a Go duration (e.g. "24h"), unset means no signing
+func loadLinkTTL() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("LINK_TTL"))
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 || ttl > maxLinkTTL {
+		return 0, fmt.Errorf("invalid LINK_TTL %q: must be a positive duration of at most 168h", value)
+	}
+	return ttl, nil
+}
+
+// defaultRequestTimeout bounds a whole request when REQUEST_TIMEOUT is unset
+const defaultRequestTimeout = 120 * time.Second
+
+// loadRequestTimeout parses REQUEST_TIMEOUT as a Go duration (e.g. "90s")
+func loadRequestTimeout() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("REQUEST_TIMEOUT"))
+	if value == "" {
+		return defaultRequestTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid REQUEST_TIMEOUT %q: must be a positive duration", value)
+	}
+	return timeout, nil
+}
+
+// loadDefaultQuality parses DEFAULT_QUALITY, falling back to HD when unset
+func loadDefaultQuality() (QualityType, error) {
+	value := strings.ToUpper(strings.TrimSpace(os.Getenv("DEFAULT_QUALITY")))
+	switch QualityType(value) {
+	case "":
+		return HD, nil
+	case HD, SD:
+		return QualityType(value), nil
+	default:
+		return "", fmt.Errorf("invalid DEFAULT_QUALITY %q: must be HD or SD", value)
+	}
+}
+
 func main() {
+	slog.SetDefault(newLogger())
+
 	err := godotenv.Load()
 
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
+
+	defaultQuality, err = loadDefaultQuality()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defaultMinWidth, err = loadDefaultMinWidth()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maxConcurrency, err = loadMaxConcurrency()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	jpegQuality, err = loadJPEGQuality()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pathTemplate, err = loadPathTemplate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maxSlides, err = loadMaxSlides()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	imageTimeout, err = loadImageTimeout()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	linkTTL, err = loadLinkTTL()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	maxImageBytes, err = loadMaxImageBytes()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tempDir, err = loadTempDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+	sweepAge, err := loadTempSweepAge()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tempSweep = sweepAge > 0
+	if tempSweep {
+		removeTempFiles(sweepAge)
+	}
+
+	proxyDial, err = loadProxyDial()
+	if err != nil {
+		log.Fatal(err)
+	}
+	outboundClient = newOutboundClient()
+
+	tracerProvider, err = loadTracing(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	apiKeys = loadAPIKeys("API_KEYS")
+	trustedAPIKeys = loadAPIKeys("TRUSTED_API_KEYS")
+	apiKeyMaxQuality, err = loadAPIKeyMaxQuality()
+	if err != nil {
+		log.Fatal(err)
+	}
+	rejectOverQuality, err = loadQualityCapMode()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	validate = newValidator()
+	startJobWorkers()
+
+	requestTimeout, err := loadRequestTimeout()
+	if err != nil {
+		log.Fatal(err)
+	}
+	batchTimeout, err := loadBatchTimeout()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app := fiber.New(fiber.Config{
 		ErrorHandler: customErrorHandler,
 	})
 
-	// Routes
+	// Middleware
+	app.Use(requestLogger())
+	app.Use(tracingMiddleware())
+	app.Use(timeoutMiddleware(requestTimeout, map[string]time.Duration{"/convert/batch": batchTimeout}))
+
+	// Routes, /convert, /convert/batch, /card and /jobs share one per-key quota
+	rateLimit := apiRateLimiter()
 	app.Get("/", rootHandler)
-	app.Get("/convert", convertHandler)
+	app.Get("/convert", requireAPIKey(), rateLimit, convertHandler)
+	app.Post("/convert/batch", requireAPIKey(), rateLimit, batchHandler)
+	app.Get("/card", requireAPIKey(), rateLimit, cardHandler)
+	app.Get("/proxy", proxyRateLimiter(), proxyHandler)
+	app.Get("/health", healthHandler)
+	app.Get("/metrics", metricsHandler())
+	app.Post("/jobs", requireAPIKey(), rateLimit, createJobHandler)
+	app.Get("/jobs/:id", requireAPIKey(), getJobHandler)
+	app.Get("/files/*", filesHandler)
+	app.Delete("/cache", requireTrustedAPIKey(), purgeCacheHandler)
 
 	// Start server
-	log.Fatal(app.Listen(":9002"))
+	go func() {
+		if err := app.Listen(":9002"); err != nil {
+			log.Fatal(err)
+		}
+	}()
+
+	// Finish in-flight conversions and uploads before exiting on SIGINT/SIGTERM
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+
+	slog.Info("shutting down, waiting for in-flight conversions")
+	if err := shutdown(app, shutdownTimeout()); err != nil {
+		slog.Error("shutdown incomplete", "error", err)
+	}
+}
+
+// timeoutMiddleware gives every request a context that is canceled after
+// timeout, or the path's entry in overrides, so in-flight conversions stop
+// downloading, and maps an expired deadline to a 504 in the standard error shape
+func timeoutMiddleware(timeout time.Duration, overrides map[string]time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		timeout := timeout
+		if override, ok := overrides[strings.TrimSuffix(c.Path(), "/")]; ok {
+			timeout = override
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		// Only a failure the deadline caused is a timeout. A handler that
+		// answered, or failed for its own reasons, as it passed keeps its response.
+		if errors.Is(err, context.DeadlineExceeded) && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &CustomAPIError{
+				StatusCode: fiber.StatusGatewayTimeout,
+				Code:       CodeTimeout,
+				Detail:     fmt.Sprintf("Request did not finish within %s, try a smaller deck or slide range, or POST /jobs", timeout),
+			}
+		}
+		return err
+	}
+}
+
+// errorFields returns the detail and code clients see for err
+func errorFields(err error) (string, string) {
+	var apiErr *CustomAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Detail, apiErr.Code
+	}
+	return err.Error(), CodeInternal
 }
 
 // Custom error handler
 func customErrorHandler(ctx *fiber.Ctx, err error) error {
 	// Default 500 status code
 	code := fiber.StatusInternalServerError
+	errCode := CodeInternal
 	detail := "Internal Server Error"
 
 	// Check for custom error
@@ -64,12 +498,19 @@ func customErrorHandler(ctx *fiber.Ctx, err error) error {
 	if errors.As(err, &apiErr) {
 		code = apiErr.StatusCode
 		detail = apiErr.Detail
+		if apiErr.Code != "" {
+			errCode = apiErr.Code
+		}
+		if apiErr.RetryAfter > 0 {
+			ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(apiErr.RetryAfter))
+		}
 	}
 
 	// Return JSON response
 	return ctx.Status(code).JSON(fiber.Map{
 		"success": false,
 		"error":   true,
+		"code":    errCode,
 		"detail":  detail,
 	})
 }
@@ -110,38 +551,334 @@ func rootHandler(c *fiber.Ctx) error {
 
 // Query parameters struct
 type ConvertParams struct {
-	URL            string               `query:"url" validate:"required"`
-	ConversionType SlidesConversionType `query:"conversion_type" validate:"required,oneof=pdf pptx images_zip"`
-	Quality        QualityType          `query:"quality" validate:"omitempty,oneof=hd sd"`
+	URL            string               `query:"url" validate:"required_without=ID,excluded_with=ID"`
+	ID             string               `query:"id" validate:"omitempty,numeric"`
+	ConversionType SlidesConversionType `query:"conversion_type" validate:"required,oneof=PDF PPTX IMAGES_ZIP HTML JSON CONTACT_SHEET DOCX TIFF"`
+	Quality        QualityType          `query:"quality" validate:"omitempty,oneof=HD SD"`
+	Stats          bool                 `query:"stats"`
+	Width          int                  `query:"width" validate:"min=0"`
+	MinWidth       *int                 `query:"min_width" validate:"omitempty,min=0"`
+	NotifyEmail    string               `query:"notify_email" validate:"omitempty,email"`
+	SlideIndex     bool                 `query:"slide_index"`
+	Manifest       bool                 `query:"include_manifest"`
+	NamePattern    string               `query:"name_pattern" validate:"max=100"`
+	FailFast       bool                 `query:"fail_fast"`
+	PageMode       string               `query:"page_mode" validate:"omitempty,oneof=fit-a4 match-image"`
+	PageBackground string               `query:"page_background"`
+	RemoteDir      string               `query:"remote_dir"`
+	ZipLayout      string               `query:"zip_layout" validate:"omitempty,oneof=flat gallery"`
+	HeadCheck      bool                 `query:"head_check"`
+	PreviewRes     int                  `query:"preview_resolution" validate:"min=0"`
+	MaxDimension   int                  `query:"max_dimension" validate:"min=0"`
+	SheetColumns   int                  `query:"sheet_columns" validate:"min=0,max=20"`
+	SheetCellWidth int                  `query:"sheet_cell_width" validate:"min=0,max=2048"`
+	TIFFCompress   string               `query:"tiff_compression" validate:"omitempty,oneof=none deflate"`
+	Watermark      string               `query:"watermark" validate:"max=100"`
+	Delivery       string               `query:"delivery" validate:"omitempty,oneof=storage ftp stream"`
+	Storage        string               `query:"storage" validate:"omitempty,oneof=ftp sftp s3 gcs azblob local"`
+	From           int                  `query:"from" validate:"min=0"`
+	To             int                  `query:"to" validate:"min=0"`
+	MaxSlides      int                  `query:"max_slides" validate:"min=0"`
+	DryRun         bool                 `query:"dry_run"`
+	ImageFormat    string               `query:"image_format" validate:"omitempty,oneof=jpeg png webp"`
+	SlideSize      string               `query:"slide_size" validate:"omitempty,oneof=auto 4:3 16:9"`
 }
 
-func convertHandler(c *fiber.Ctx) error {
+// normalize trims inputs and upper-cases enum values so "pdf" and "PDF" are equivalent
+func (p *ConvertParams) normalize() {
+	p.URL = strings.TrimSpace(p.URL)
+	p.ID = strings.TrimSpace(p.ID)
+	p.ConversionType = SlidesConversionType(strings.ToUpper(strings.TrimSpace(string(p.ConversionType))))
+	p.Quality = QualityType(strings.ToUpper(strings.TrimSpace(string(p.Quality))))
+	p.NotifyEmail = strings.TrimSpace(p.NotifyEmail)
+	p.ZipLayout = strings.ToLower(strings.TrimSpace(p.ZipLayout))
+	p.PageMode = strings.ToLower(strings.TrimSpace(p.PageMode))
+	p.TIFFCompress = strings.ToLower(strings.TrimSpace(p.TIFFCompress))
+	p.Watermark = strings.TrimSpace(p.Watermark)
+	p.Delivery = strings.ToLower(strings.TrimSpace(p.Delivery))
+	p.Storage = strings.ToLower(strings.TrimSpace(p.Storage))
+	p.ImageFormat = strings.ToLower(strings.TrimSpace(p.ImageFormat))
+	p.SlideSize = strings.ToLower(strings.TrimSpace(p.SlideSize))
+	p.NamePattern = strings.TrimSpace(p.NamePattern)
+}
+
+// options applies server defaults and converts validated params into ConversionOptions
+func (p *ConvertParams) options() (ConversionOptions, error) {
+	if p.Quality == "" {
+		p.Quality = defaultQuality // Default to DEFAULT_QUALITY if not specified
+	}
+	// A sent min_width, even 0 to turn the guard off, overrides MIN_WIDTH
+	minWidth := defaultMinWidth
+	if p.MinWidth != nil {
+		minWidth = *p.MinWidth
+	}
+
+	opts := ConversionOptions{
+		IncludeStats:      p.Stats,
+		Width:             p.Width,
+		MinWidth:          minWidth,
+		NotifyEmail:       p.NotifyEmail,
+		SlideIndex:        p.SlideIndex,
+		IncludeManifest:   p.Manifest,
+		NamePattern:       p.NamePattern,
+		FailFast:          p.FailFast,
+		ZipLayout:         p.ZipLayout,
+		PageMode:          p.PageMode,
+		HeadCheck:         p.HeadCheck,
+		PreviewResolution: p.PreviewRes,
+		MaxDimension:      p.MaxDimension,
+		SheetColumns:      p.SheetColumns,
+		SheetCellWidth:    p.SheetCellWidth,
+		TIFFCompression:   p.TIFFCompress,
+		MaxConcurrency:    maxConcurrency,
+		JPEGQuality:       jpegQuality,
+		From:              p.From,
+		To:                p.To,
+		MaxSlides:         maxSlides,
+		Client:            outboundClient,
+		DryRun:            p.DryRun,
+		ImageFormat:       p.ImageFormat,
+		SlideSize:         p.SlideSize,
+		ImageTimeout:      imageTimeout,
+	}
+	opts.Watermark, opts.NoWatermark = resolveWatermark(p.Watermark)
+	if p.MaxSlides > 0 {
+		opts.MaxSlides = p.MaxSlides
+	}
+
+	if p.PageBackground != "" {
+		background, err := parseHexColor(p.PageBackground)
+		if err != nil {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "Invalid page_background, expected a hex color like #1e1e1e",
+			}
+		}
+		opts.PageBackground = &background
+	}
+
+	if p.RemoteDir != "" {
+		remoteDir, err := sanitizeRemoteDir(p.RemoteDir)
+		if err != nil {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "Invalid remote_dir: " + err.Error(),
+			}
+		}
+		opts.RemoteDir = remoteDir
+	}
+
+	if p.ImageFormat != "" && p.ImageFormat != ImageFormatJPEG && p.ConversionType != ImagesZip {
+		return opts, &CustomAPIError{
+			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidParams,
+			Detail:     "image_format supports png and webp only for IMAGES_ZIP",
+		}
+	}
+
+	if p.Manifest && p.ConversionType != ImagesZip {
+		return opts, &CustomAPIError{
+			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidParams,
+			Detail:     "include_manifest is supported only for IMAGES_ZIP",
+		}
+	}
+
+	if p.NamePattern != "" {
+		if p.ConversionType != ImagesZip {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "name_pattern is supported only for IMAGES_ZIP",
+			}
+		}
+		if err := validateNamePattern(p.NamePattern); err != nil {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "Invalid name_pattern: " + err.Error(),
+			}
+		}
+	}
+
+	if p.Storage != "" {
+		if backends := enabledStorageBackends(); !slices.Contains(backends, p.Storage) {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     fmt.Sprintf("storage %q is not configured, use one of %s", p.Storage, strings.Join(backends, ", ")),
+			}
+		}
+		opts.StorageBackend = p.Storage
+	}
+
+	if p.Delivery == DeliveryStream {
+		if _, ok := streamContentTypes[p.ConversionType]; !ok {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "delivery=stream supports only PDF, PPTX and IMAGES_ZIP",
+			}
+		}
+		if p.SlideIndex || p.NotifyEmail != "" || p.Storage != "" {
+			return opts, &CustomAPIError{
+				StatusCode: fiber.StatusBadRequest,
+				Code:       CodeInvalidParams,
+				Detail:     "delivery=stream cannot be combined with slide_index, notify_email or storage",
+			}
+		}
+	}
+
+	return opts, nil
+}
+
+// validateParams runs the struct's validate tags and reports every failing field
+func validateParams(params interface{}) error {
+	err := validate.Struct(params)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "Invalid query parameters"}
+	}
+
+	problems := make([]string, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		switch fieldErr.Tag() {
+		case "required", "required_without":
+			problems = append(problems, fieldErr.Field()+" is required")
+		case "excluded_with":
+			problems = append(problems, fieldErr.Field()+" can't be combined with "+strings.ToLower(fieldErr.Param()))
+		case "oneof":
+			problems = append(problems, fmt.Sprintf("%s must be one of [%s]", fieldErr.Field(), fieldErr.Param()))
+		default:
+			problems = append(problems, fmt.Sprintf("%s failed %s validation", fieldErr.Field(), fieldErr.Tag()))
+		}
+	}
+
+	return &CustomAPIError{
+		StatusCode: fiber.StatusBadRequest,
+		Code:       CodeInvalidParams,
+		Detail:     "Invalid parameters: " + strings.Join(problems, "; "),
+	}
+}
+
+func cardHandler(c *fiber.Ctx) error {
+	if err := checkEnvelope(c); err != nil {
+		return err
+	}
+	urlStr := c.Query("url")
+	if strings.TrimSpace(urlStr) == "" {
+		return &CustomAPIError{
+			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidURL,
+			Detail:     "Url can't be empty",
+		}
+	}
+
+	result, err := GetSlideCard(c.UserContext(), urlStr)
+	if err != nil {
+		return err
+	}
+
+	return writeResult(c, result)
+}
+
+// parseConvertParams parses, validates and resolves the conversion query
+// params shared by /convert and /jobs
+func parseConvertParams(c *fiber.Ctx) (*ConvertParams, ConversionOptions, error) {
+	if err := checkEnvelope(c); err != nil {
+		return nil, ConversionOptions{}, err
+	}
 	params := new(ConvertParams)
 
 	// Parse query parameters
 	if err := c.QueryParser(params); err != nil {
-		return &CustomAPIError{
+		return nil, ConversionOptions{}, &CustomAPIError{
 			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidParams,
 			Detail:     "Invalid query parameters",
 		}
 	}
 
 	// Validate parameters
-	if strings.TrimSpace(params.URL) == "" {
-		return &CustomAPIError{
-			StatusCode: fiber.StatusBadRequest,
-			Detail:     "Url can't be empty",
+	params.normalize()
+	if err := validateParams(params); err != nil {
+		return nil, ConversionOptions{}, err
+	}
+	if params.MaxSlides > 0 && !isTrustedRequest(c) {
+		return nil, ConversionOptions{}, &CustomAPIError{
+			StatusCode: fiber.StatusForbidden,
+			Code:       CodeForbidden,
+			Detail:     "max_slides requires a trusted API key",
 		}
 	}
 
-	if params.Quality == "" {
-		params.Quality = HD // Default to HD if not specified
+	if params.ID != "" {
+		deckURL, err := ResolveDeckURL(c.UserContext(), outboundClient, params.ID)
+		if err != nil {
+			return nil, ConversionOptions{}, err
+		}
+		params.URL = deckURL
 	}
 
-	result, err := GetSlidesDownloadLink(params.URL, params.ConversionType, params.Quality)
+	opts, err := params.options()
+	if err != nil {
+		return nil, ConversionOptions{}, err
+	}
+	opts.MaxQuality = requestMaxQuality(c)
+
+	return params, opts, nil
+}
+
+func convertHandler(c *fiber.Ctx) error {
+	params, opts, err := parseConvertParams(c)
 	if err != nil {
 		return err
 	}
 
+	if params.Delivery == DeliveryStream && !params.DryRun {
+		return streamConversion(c, params, opts)
+	}
+
+	result, err := GetSlidesDownloadLink(c.UserContext(), params.URL, params.ConversionType, params.Quality, opts)
+	if err != nil {
+		return err
+	}
+
+	return writeResult(c, result)
+}
+
+// checkEnvelope rejects an unsupported envelope query param. Handlers call it
+// before doing any work, writeResult only runs once the result exists.
+func checkEnvelope(c *fiber.Ctx) error {
+	switch c.Query("envelope", "nested") {
+	case "nested", "flat":
+		return nil
+	default:
+		return &CustomAPIError{
+			StatusCode: fiber.StatusBadRequest,
+			Code:       CodeInvalidParams,
+			Detail:     "Invalid envelope, must be nested or flat",
+		}
+	}
+}
+
+// writeResult sends a successful result using the envelope requested via the
+// envelope query param: "nested" (default) keeps success/data, "flat" returns
+// the data contents at the top level. Errors always use customErrorHandler.
+func writeResult(c *fiber.Ctx, result map[string]interface{}) error {
+	if err := checkEnvelope(c); err != nil {
+		return err
+	}
+	if c.Query("envelope") == "flat" {
+		if data, ok := result["data"].(map[string]interface{}); ok {
+			return c.JSON(data)
+		}
+	}
 	return c.JSON(result)
 }
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConvertParamsNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   ConvertParams
+		want ConvertParams
+	}{
+		{
+			name: "trims url and id",
+			in:   ConvertParams{URL: "  https://www.slideshare.net/a/b \n", ID: " 123 "},
+			want: ConvertParams{URL: "https://www.slideshare.net/a/b", ID: "123"},
+		},
+		{
+			name: "upper-cases conversion type and quality",
+			in:   ConvertParams{ConversionType: " pdf ", Quality: "sd"},
+			want: ConvertParams{ConversionType: PDF, Quality: "SD"},
+		},
+		{
+			name: "lower-cases the other enums",
+			in: ConvertParams{
+				ZipLayout:    "Gallery",
+				PageMode:     "FIT-A4",
+				TIFFCompress: " Deflate",
+				Delivery:     "STREAM",
+				ImageFormat:  "PNG ",
+				SlideSize:    "AUTO",
+			},
+			want: ConvertParams{
+				ZipLayout:    "gallery",
+				PageMode:     "fit-a4",
+				TIFFCompress: "deflate",
+				Delivery:     "stream",
+				ImageFormat:  "png",
+				SlideSize:    "auto",
+			},
+		},
+		{
+			name: "trims free text without changing case",
+			in:   ConvertParams{NotifyEmail: " A@example.com ", Watermark: " Draft ", NamePattern: " Slide_{index}.{ext} "},
+			want: ConvertParams{NotifyEmail: "A@example.com", Watermark: "Draft", NamePattern: "Slide_{index}.{ext}"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in
+			got.normalize()
+			if got != tt.want {
+				t.Errorf("normalize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseConvertParams(t *testing.T) {
+	validate = newValidator()
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("STORAGE_BACKENDS", "local")
+
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/convert", func(c *fiber.Ctx) error {
+		params, _, err := parseConvertParams(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(params)
+	})
+
+	const deck = "url=https://www.slideshare.net/a/b"
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantCode   string
+		wantType   SlidesConversionType
+	}{
+		{name: "lower-case conversion type", query: deck + "&conversion_type=pdf", wantStatus: 200, wantType: PDF},
+		{name: "padded conversion type", query: deck + "&conversion_type=%20images_zip%20", wantStatus: 200, wantType: ImagesZip},
+		{name: "missing conversion type", query: deck, wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "unknown conversion type", query: deck + "&conversion_type=GIF", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "missing url and id", query: "conversion_type=PDF", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "invalid quality", query: deck + "&conversion_type=PDF&quality=UHD", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "lower-case quality", query: deck + "&conversion_type=PDF&quality=sd", wantStatus: 200, wantType: PDF},
+		{name: "url with id", query: deck + "&id=123&conversion_type=PDF", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "bad envelope", query: deck + "&conversion_type=PDF&envelope=xml", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "stream of unsupported type", query: deck + "&conversion_type=HTML&delivery=STREAM", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "manifest outside IMAGES_ZIP", query: deck + "&conversion_type=PDF&include_manifest=true", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "max_slides without trusted key", query: deck + "&conversion_type=PDF&max_slides=10", wantStatus: 403, wantCode: CodeForbidden},
+		{name: "non-numeric from", query: deck + "&conversion_type=PDF&from=one", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "enabled storage", query: deck + "&conversion_type=PDF&storage=LOCAL", wantStatus: 200, wantType: PDF},
+		{name: "default storage", query: deck + "&conversion_type=PDF&storage=ftp", wantStatus: 200, wantType: PDF},
+		{name: "storage not configured", query: deck + "&conversion_type=PDF&storage=s3", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "unknown storage", query: deck + "&conversion_type=PDF&storage=dropbox", wantStatus: 400, wantCode: CodeInvalidParams},
+		{name: "storage with stream", query: deck + "&conversion_type=PDF&delivery=stream&storage=local", wantStatus: 400, wantCode: CodeInvalidParams},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/convert?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			var body struct {
+				Code           string               `json:"code"`
+				ConversionType SlidesConversionType `json:"ConversionType"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+			if body.ConversionType != tt.wantType {
+				t.Errorf("conversion type = %q, want %q", body.ConversionType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestMinWidthParam(t *testing.T) {
+	validate = newValidator()
+	saved := defaultMinWidth
+	defaultMinWidth = 500
+	defer func() { defaultMinWidth = saved }()
+
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/convert", func(c *fiber.Ctx) error {
+		_, opts, err := parseConvertParams(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(fiber.Map{"min_width": opts.MinWidth})
+	})
+
+	const query = "url=https://www.slideshare.net/a/b&conversion_type=PDF"
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		want       int
+	}{
+		{name: "omitted uses MIN_WIDTH", query: query, wantStatus: 200, want: 500},
+		{name: "zero disables the guard", query: query + "&min_width=0", wantStatus: 200, want: 0},
+		{name: "explicit width", query: query + "&min_width=800", wantStatus: 200, want: 800},
+		{name: "negative width", query: query + "&min_width=-1", wantStatus: 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/convert?"+tt.query, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+			var body struct {
+				MinWidth int `json:"min_width"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.MinWidth != tt.want {
+				t.Errorf("MinWidth = %d, want %d", body.MinWidth, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	const timeout = 20 * time.Millisecond
+	tests := []struct {
+		name    string
+		handler fiber.Handler
+		want    int
+	}{
+		{"fails on the deadline", func(c *fiber.Ctx) error {
+			<-c.UserContext().Done()
+			return c.UserContext().Err()
+		}, fiber.StatusGatewayTimeout},
+		{"answers after the deadline", func(c *fiber.Ctx) error {
+			<-c.UserContext().Done()
+			return c.SendStatus(fiber.StatusOK)
+		}, fiber.StatusOK},
+		{"rejects the request after the deadline", func(c *fiber.Ctx) error {
+			<-c.UserContext().Done()
+			return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidParams, Detail: "bad"}
+		}, fiber.StatusBadRequest},
+		{"own shorter timeout expires", func(c *fiber.Ctx) error {
+			ctx, cancel := context.WithTimeout(c.UserContext(), time.Millisecond)
+			defer cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		}, fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+			app.Use(timeoutMiddleware(timeout, nil))
+			app.Get("/", tt.handler)
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// pipelineGoroutines counts the goroutines running this package's code,
+// other than tests. fasthttp's own housekeeping goroutines don't count.
+func pipelineGoroutines() int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	count := 0
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		if strings.Contains(stack, "mymodule.") && !strings.Contains(stack, "mymodule.Test") {
+			count++
+		}
+	}
+	return count
+}
+
+func TestConvertTimesOut(t *testing.T) {
+	tests := []struct {
+		name string
+		// slow reports whether slide n hangs until the test releases it
+		slow func(n int) bool
+	}{
+		{name: "every slide is slow", slow: func(n int) bool { return true }},
+		{name: "one slide never arrives", slow: func(n int) bool { return n == 3 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := withTempDir(t)
+			fake := newFakeSlideShare(t, 4)
+			release := make(chan struct{})
+			fake.serveImage = func(w http.ResponseWriter, r *http.Request, n int) {
+				if tt.slow(n) {
+					select {
+					case <-release:
+					case <-time.After(10 * time.Second):
+					}
+				}
+				w.Write(slideJPEG(n))
+			}
+			app := jobApp(t, fake)
+			app.Use(timeoutMiddleware(200*time.Millisecond, nil))
+			app.Get("/convert", convertHandler)
+
+			query := url.Values{"url": {fake.deckURL(t)}, "conversion_type": {string(PDF)}, "quality": {string(HD)}}
+			start := time.Now()
+			resp, err := app.Test(httptest.NewRequest("GET", "/convert?"+query.Encode(), nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.NewDecoder(resp.Body).Decode(&body)
+			if resp.StatusCode != fiber.StatusGatewayTimeout || body.Code != CodeTimeout {
+				t.Fatalf("got %d %s, want %d %s", resp.StatusCode, body.Code, fiber.StatusGatewayTimeout, CodeTimeout)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("timeout fired after %s", elapsed)
+			}
+
+			// The downloads that did finish are removed with the failed conversion
+			if leftovers := waitForEmptyDir(dir, time.Second); len(leftovers) != 0 {
+				t.Errorf("timed out conversion left %v in the temp dir", leftovers)
+			}
+
+			// Abandoned downloads end with the stub, giving back their host
+			// slots, and nothing of the request keeps running
+			close(release)
+			fake.server.Close()
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				busy := sharedHostLimiter().snapshot()["image.slidesharecdn.com"]
+				leaked := pipelineGoroutines()
+				if busy == 0 && leaked == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("after the timeout %d host slots are held and %d goroutines still run", busy, leaked)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
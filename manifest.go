@@ -0,0 +1,53 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+)
+
+// zipManifestSlide is one slide in an IMAGES_ZIP manifest.json: its slide
+// index entry plus the archive entry holding the image
+type zipManifestSlide struct {
+	slideIndexEntry
+	File string `json:"file"`
+}
+
+// zipManifest is the manifest.json include_manifest adds to IMAGES_ZIP archives
+type zipManifest struct {
+	Title      string             `json:"title"`
+	SlideCount int                `json:"slide_count"`
+	Slides     []zipManifestSlide `json:"slides"`
+}
+
+// newZipManifest describes the slides kept after download, in the same order
+// as the downloaded images
+func newZipManifest(title string, index []slideIndexEntry) *zipManifest {
+	manifest := &zipManifest{Title: title, SlideCount: len(index), Slides: make([]zipManifestSlide, len(index))}
+	for i, entry := range index {
+		manifest.Slides[i].slideIndexEntry = entry
+	}
+	return manifest
+}
+
+// writeZipManifest adds manifest.json to the archive, entryNames[i] being
+// the entry of slide i. A nil manifest writes nothing.
+func writeZipManifest(zipWriter *zip.Writer, manifest *zipManifest, entryNames []string) error {
+	if manifest == nil {
+		return nil
+	}
+	for i := range manifest.Slides {
+		if i < len(entryNames) {
+			manifest.Slides[i].File = entryNames[i]
+		}
+	}
+
+	manifestEntry, err := zipWriter.Create("manifest.json")
+	if err != nil {
+		return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to create zip entry: %v", err)}
+	}
+	if err := json.NewEncoder(manifestEntry).Encode(manifest); err != nil {
+		return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// jsonLDDocument holds the JSON-LD fields SlideShare publishes for a deck
+type jsonLDDocument struct {
+	Description          string          `json:"description"`
+	DatePublished        string          `json:"datePublished"`
+	Author               json.RawMessage `json:"author"`
+	InteractionStatistic json.RawMessage `json:"interactionStatistic"`
+}
+
+// jsonLDInteraction is one schema.org InteractionCounter
+type jsonLDInteraction struct {
+	InteractionType      interface{} `json:"interactionType"`
+	UserInteractionCount interface{} `json:"userInteractionCount"`
+}
+
+// extractDeckMetadata collects author, description, publish date and view
+// count from JSON-LD, Open Graph and plain meta tags, in that order of
+// preference. Fields that can't be found are left out.
+func extractDeckMetadata(doc *goquery.Document) map[string]interface{} {
+	metadata := make(map[string]interface{})
+	setString := func(key, value string) {
+		if _, ok := metadata[key]; !ok {
+			if value = strings.TrimSpace(value); value != "" {
+				metadata[key] = value
+			}
+		}
+	}
+
+	doc.Find("script[type='application/ld+json']").Each(func(_ int, s *goquery.Selection) {
+		var ld jsonLDDocument
+		if err := json.Unmarshal([]byte(s.Text()), &ld); err != nil {
+			return
+		}
+		setString("author", jsonLDAuthorName(ld.Author))
+		setString("description", ld.Description)
+		setString("published_at", ld.DatePublished)
+		if _, ok := metadata["view_count"]; !ok {
+			if views, ok := jsonLDViewCount(ld.InteractionStatistic); ok {
+				metadata["view_count"] = views
+			}
+		}
+	})
+
+	meta := func(selector string) string {
+		return doc.Find(selector).AttrOr("content", "")
+	}
+	setString("author", meta("meta[name='author']"))
+	setString("description", meta("meta[property='og:description']"))
+	setString("description", meta("meta[name='description']"))
+	setString("published_at", meta("meta[property='article:published_time']"))
+
+	return metadata
+}
+
+// jsonLDAuthorName accepts an author given as a string, an object or a list
+func jsonLDAuthorName(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var name string
+	if json.Unmarshal(raw, &name) == nil {
+		return name
+	}
+
+	var person struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(raw, &person) == nil && person.Name != "" {
+		return person.Name
+	}
+
+	var people []struct {
+		Name string `json:"name"`
+	}
+	if json.Unmarshal(raw, &people) == nil && len(people) > 0 {
+		return people[0].Name
+	}
+	return ""
+}
+
+// jsonLDViewCount finds the WatchAction/ViewAction counter in interactionStatistic
+func jsonLDViewCount(raw json.RawMessage) (int64, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+
+	var stats []jsonLDInteraction
+	if json.Unmarshal(raw, &stats) != nil {
+		var single jsonLDInteraction
+		if json.Unmarshal(raw, &single) != nil {
+			return 0, false
+		}
+		stats = []jsonLDInteraction{single}
+	}
+
+	for _, stat := range stats {
+		kind, _ := stat.InteractionType.(string)
+		if typed, ok := stat.InteractionType.(map[string]interface{}); ok {
+			kind, _ = typed["@type"].(string)
+		}
+		if !strings.HasSuffix(kind, "WatchAction") && !strings.HasSuffix(kind, "ViewAction") {
+			continue
+		}
+
+		switch count := stat.UserInteractionCount.(type) {
+		case float64:
+			return int64(count), true
+		case string:
+			if v, err := strconv.ParseInt(strings.ReplaceAll(count, ",", ""), 10, 64); err == nil {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	conversionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ssdl_conversions_total",
+		Help: "Conversions by type and outcome: success, cached, dry_run or the error code.",
+	}, []string{"conversion_type", "outcome"})
+
+	conversionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ssdl_conversion_duration_seconds",
+		Help:    "Time from request to uploaded output, cache hits excluded.",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"conversion_type"})
+
+	outputSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ssdl_output_size_bytes",
+		Help:    "Size of generated output files.",
+		Buckets: prometheus.ExponentialBuckets(64<<10, 4, 8), // 64KiB to 1GiB
+	}, []string{"conversion_type"})
+
+	conversionsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ssdl_conversions_in_flight",
+		Help: "Conversions currently running, including background jobs.",
+	})
+
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ssdl_http_requests_total",
+		Help: "HTTP requests by route and status code.",
+	}, []string{"route", "status"})
+
+	hostRequestsDesc = prometheus.NewDesc(
+		"ssdl_host_requests_in_flight",
+		"Outbound requests currently holding a per-host slot.",
+		[]string{"host"}, nil,
+	)
+)
+
+func init() {
+	prometheus.MustRegister(hostLimiterCollector{})
+}
+
+// hostLimiterCollector reports the shared host limiter's in-flight counts at scrape time
+type hostLimiterCollector struct{}
+
+func (hostLimiterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hostRequestsDesc
+}
+
+func (hostLimiterCollector) Collect(ch chan<- prometheus.Metric) {
+	for host, n := range sharedHostLimiter().snapshot() {
+		ch <- prometheus.MustNewConstMetric(hostRequestsDesc, prometheus.GaugeValue, float64(n), host)
+	}
+}
+
+// metricsHandler serves the default Prometheus registry
+func metricsHandler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
+
+// observeConversion records one finished conversion started at start
+func observeConversion(conversionType SlidesConversionType, start time.Time, result map[string]interface{}, err error) {
+	label := string(conversionType)
+	if err != nil {
+		outcome := CodeInternal
+		var apiErr *CustomAPIError
+		if errors.As(err, &apiErr) && apiErr.Code != "" {
+			outcome = apiErr.Code
+		}
+		conversionsTotal.WithLabelValues(label, outcome).Inc()
+		return
+	}
+
+	data, _ := result["data"].(map[string]interface{})
+	if cached, _ := data["cached"].(bool); cached {
+		conversionsTotal.WithLabelValues(label, "cached").Inc()
+		return
+	}
+	if dryRun, _ := data["dry_run"].(bool); dryRun {
+		conversionsTotal.WithLabelValues(label, "dry_run").Inc()
+		return
+	}
+
+	conversionsTotal.WithLabelValues(label, "success").Inc()
+	conversionDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+	if size, ok := data["size"].(int64); ok {
+		outputSize.WithLabelValues(label).Observe(float64(size))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// nextDataSlides is the slide description SlideShare embeds in __NEXT_DATA__.
+// Every slide is served at
+// <host>/<imageLocation>/<quality>/<title>-<slide>-<width>.<format>.
+type nextDataSlides struct {
+	Host          string `json:"host"`
+	ImageLocation string `json:"imageLocation"`
+	Title         string `json:"title"`
+	ImageSizes    []struct {
+		Quality int    `json:"quality"`
+		Width   int    `json:"width"`
+		Format  string `json:"format"`
+	} `json:"imageSizes"`
+}
+
+// nextDataSlideshow is the part of __NEXT_DATA__ describing the deck
+type nextDataSlideshow struct {
+	TotalSlides int             `json:"totalSlides"`
+	Slides      json.RawMessage `json:"slides"`
+}
+
+// extractNextDataSlides reads the slide images from the __NEXT_DATA__ JSON
+// of pages that lazy-load their slides, in the same shape as
+// extractSlideImages. Slides are either described by a URL pattern or listed
+// with their own srcset.
+func extractNextDataSlides(ctx context.Context, doc *goquery.Document, urlStr string) []map[int]string {
+	script := doc.Find("script#__NEXT_DATA__").First().Text()
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+
+	var data struct {
+		Props struct {
+			PageProps struct {
+				Slideshow nextDataSlideshow `json:"slideshow"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+	if err := json.Unmarshal([]byte(script), &data); err != nil {
+		return nil
+	}
+	slideshow := data.Props.PageProps.Slideshow
+	if len(slideshow.Slides) == 0 {
+		return nil
+	}
+
+	var pattern nextDataSlides
+	if json.Unmarshal(slideshow.Slides, &pattern) == nil && pattern.ImageLocation != "" {
+		return expandNextDataSlides(pattern, slideshow.TotalSlides)
+	}
+
+	// encoding/json matches keys case-insensitively, so srcSet works too
+	var listed []struct {
+		Srcset string `json:"srcset"`
+	}
+	if json.Unmarshal(slideshow.Slides, &listed) != nil {
+		return nil
+	}
+	firstWins := srcsetFirstWins()
+	var allSlideImages []map[int]string
+	for i, slide := range listed {
+		slideResolutions, duplicates := parseSrcset(slide.Srcset, firstWins)
+		if len(duplicates) > 0 {
+			loggerFrom(ctx).Warn("duplicate srcset widths", "slide", i+1, "widths", duplicates, "url", urlStr)
+		}
+		if len(slideResolutions) > 0 {
+			allSlideImages = append(allSlideImages, slideResolutions)
+		}
+	}
+	return allSlideImages
+}
+
+// expandNextDataSlides builds every slide's resolutions from the URL pattern
+func expandNextDataSlides(pattern nextDataSlides, totalSlides int) []map[int]string {
+	host := strings.TrimSuffix(pattern.Host, "/")
+	if host == "" {
+		host = "https://image.slidesharecdn.com"
+	}
+
+	allSlideImages := make([]map[int]string, 0, totalSlides)
+	for slide := 1; slide <= totalSlides; slide++ {
+		slideResolutions := make(map[int]string)
+		for _, size := range pattern.ImageSizes {
+			if size.Width <= 0 {
+				continue
+			}
+			format := size.Format
+			if format == "" {
+				format = "jpg"
+			}
+			slideResolutions[size.Width] = fmt.Sprintf("%s/%s/%d/%s-%d-%d.%s", host, pattern.ImageLocation, size.Quality, pattern.Title, slide, size.Width, format)
+		}
+		if len(slideResolutions) > 0 {
+			allSlideImages = append(allSlideImages, slideResolutions)
+		}
+	}
+	return allSlideImages
+}
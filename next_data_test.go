@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// nextDataPage is a lazy-loading deck page whose slides are only described
+// by the given __NEXT_DATA__ slideshow JSON
+func nextDataPage(slideshow string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>Lazy Deck</title></head><body><div id="__next"></div>`)
+		fmt.Fprintf(w, `<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"slideshow":%s}},"page":"/[user]/[slug]"}</script>`, slideshow)
+		fmt.Fprint(w, "</body></html>")
+	}
+}
+
+func TestFetchSlideImagesFromNextData(t *testing.T) {
+	t.Setenv("RENDER_SERVICE_URL", "")
+	const cdn = "https://image.slidesharecdn.com"
+	tests := []struct {
+		name      string
+		slideshow string
+		want      []map[int]string
+		wantCode  string
+	}{
+		{
+			name:      "URL pattern",
+			slideshow: `{"totalSlides":2,"slides":{"host":"` + cdn + `/","imageLocation":"lazydeck-123/75","title":"Lazy-Deck","imageSizes":[{"quality":85,"width":320,"format":"jpg"},{"quality":85,"width":638},{"quality":75,"width":2048,"format":"webp"}]}}`,
+			want: []map[int]string{
+				{320: cdn + "/lazydeck-123/75/85/Lazy-Deck-1-320.jpg", 638: cdn + "/lazydeck-123/75/85/Lazy-Deck-1-638.jpg", 2048: cdn + "/lazydeck-123/75/75/Lazy-Deck-1-2048.webp"},
+				{320: cdn + "/lazydeck-123/75/85/Lazy-Deck-2-320.jpg", 638: cdn + "/lazydeck-123/75/85/Lazy-Deck-2-638.jpg", 2048: cdn + "/lazydeck-123/75/75/Lazy-Deck-2-2048.webp"},
+			},
+		},
+		{
+			name:      "listed srcsets",
+			slideshow: `{"totalSlides":2,"slides":[{"srcSet":"` + cdn + `/img/slide-1-638.jpg 638w, ` + cdn + `/img/slide-1-2048.jpg 2048w"},{"srcset":"` + cdn + `/img/slide-2-638.jpg 638w"}]}`,
+			want: []map[int]string{
+				{638: cdn + "/img/slide-1-638.jpg", 2048: cdn + "/img/slide-1-2048.jpg"},
+				{638: cdn + "/img/slide-2-638.jpg"},
+			},
+		},
+		{
+			name:      "no slides",
+			slideshow: `{"totalSlides":0,"slides":[]}`,
+			wantCode:  CodeNoSlidesFound,
+		},
+		{
+			name:      "malformed JSON",
+			slideshow: `{"totalSlides":2,"slides":`,
+			wantCode:  CodeNoSlidesFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlideShare(t, 0)
+			fake.servePage = nextDataPage(tt.slideshow)
+
+			result, err := FetchSlideImages(context.Background(), fake.client(), fake.deckURL(t))
+			if tt.wantCode != "" {
+				var apiErr *CustomAPIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Fatalf("FetchSlideImages error = %v, want code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := result["slides"].([]map[int]string); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("slides = %v, want %v", got, tt.want)
+			}
+			if title := result["title"]; title != "Lazy Deck" {
+				t.Errorf("title = %q, want %q", title, "Lazy Deck")
+			}
+		})
+	}
+}
+
+func TestFetchSlideImagesPrefersStaticSlides(t *testing.T) {
+	fake := newFakeSlideShare(t, 1)
+	fake.servePage = func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><body><img data-testid="vertical-slide-image" srcset="%s 638w">`, fake.imageURL(1, 638))
+		fmt.Fprint(w, `<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"slideshow":{"totalSlides":1,"slides":[{"srcset":"https://image.slidesharecdn.com/other.jpg 320w"}]}}}}</script></body></html>`)
+	}
+
+	result, err := FetchSlideImages(context.Background(), fake.client(), fake.deckURL(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[int]string{{638: fake.imageURL(1, 638)}}
+	if got := result["slides"].([]map[int]string); !reflect.DeepEqual(got, want) {
+		t.Errorf("slides = %v, want the static page's %v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// sendLinkEmail mails the download link and basic metadata to addr using the
+// SMTP_HOST, SMTP_PORT, SMTP_USER, SMTP_PASS and SMTP_FROM settings
+func sendLinkEmail(addr string, data map[string]interface{}) error {
+	smtpHost := os.Getenv("SMTP_HOST")
+	if smtpHost == "" {
+		return fmt.Errorf("SMTP_HOST is not configured")
+	}
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+	smtpUser := os.Getenv("SMTP_USER")
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = smtpUser
+	}
+
+	var auth smtp.Auth
+	if smtpUser != "" {
+		auth = smtp.PlainAuth("", smtpUser, os.Getenv("SMTP_PASS"), smtpHost)
+	}
+
+	// Keep scraped titles from injecting extra headers
+	title := strings.NewReplacer("\r", " ", "\n", " ").Replace(fmt.Sprint(data["title"]))
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", from)
+	fmt.Fprintf(&body, "To: %s\r\n", addr)
+	fmt.Fprintf(&body, "Subject: Your slides are ready: %s\r\n", title)
+	body.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&body, "Title: %s\r\n", title)
+	fmt.Fprintf(&body, "Format: %v (%v)\r\n", data["conversion_type"], data["quality"])
+	fmt.Fprintf(&body, "File: %v (%v bytes)\r\n\r\n", data["file_name"], data["size"])
+	fmt.Fprintf(&body, "Download: %v\r\n", data["slides_download_link"])
+
+	return smtp.SendMail(net.JoinHostPort(smtpHost, smtpPort), auth, from, []string{addr}, []byte(body.String()))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpproxy"
+)
+
+// Shared client tuning. Per-request deadlines come from doWithContext; these
+// bound stalled connections underneath them.
+const (
+	outboundReadTimeout     = 30 * time.Second
+	outboundWriteTimeout    = 10 * time.Second
+	outboundMaxIdleDuration = 90 * time.Second
+	outboundConnWaitTimeout = 5 * time.Second
+)
+
+// outboundClient is shared by every request to SlideShare and its CDNs so
+// connections are reused across conversions. It is created in main once the
+// environment is loaded and reaches conversions through ConversionOptions.
+var outboundClient *fasthttp.Client
+
+// newOutboundClient builds the shared client, allowing one connection per
+// host limiter slot. Abandoned requests may briefly hold extra connections,
+// so callers wait for a free one rather than failing. Response bodies are
+// capped at MAX_IMAGE_BYTES; deck pages are far smaller than any slide limit.
+func newOutboundClient() *fasthttp.Client {
+	return &fasthttp.Client{
+		Dial:                outboundDial,
+		MaxConnsPerHost:     int(sharedHostLimiter().limit),
+		MaxConnWaitTimeout:  outboundConnWaitTimeout,
+		ReadTimeout:         outboundReadTimeout,
+		WriteTimeout:        outboundWriteTimeout,
+		MaxIdleConnDuration: outboundMaxIdleDuration,
+		MaxResponseBodySize: maxImageBytes,
+	}
+}
+
+// proxyDialTimeout bounds connecting to PROXY_URL, including the CONNECT handshake
+const proxyDialTimeout = 10 * time.Second
+
+// proxyDial routes SlideShare traffic through PROXY_URL, set at startup.
+// Nil connects directly.
+var proxyDial fasthttp.DialFunc
+
+// loadProxyDial parses PROXY_URL, either http://[user:pass@]host:port
+// or socks5://[user:pass@]host:port
+func loadProxyDial() (fasthttp.DialFunc, error) {
+	value := strings.TrimSpace(os.Getenv("PROXY_URL"))
+	if value == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || u.Port() == "" {
+		return nil, fmt.Errorf("invalid PROXY_URL %q: expected scheme://host:port", value)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		// fasthttpproxy takes the proxy as [user:pass@]host:port
+		addr := u.Host
+		if u.User != nil {
+			addr = u.User.String() + "@" + addr
+		}
+		return fasthttpproxy.FasthttpHTTPDialerTimeout(addr, proxyDialTimeout), nil
+	case "socks5":
+		return fasthttpproxy.FasthttpSocksDialer(value), nil
+	default:
+		return nil, fmt.Errorf("invalid PROXY_URL %q: scheme must be http or socks5", value)
+	}
+}
+
+// outboundDial is the Dial of every client that talks to SlideShare or its
+// CDNs. Internal services such as the render service connect directly,
+// webhooks through publicDial.
+func outboundDial(addr string) (net.Conn, error) {
+	if proxyDial != nil {
+		return proxyDial(addr)
+	}
+	return fasthttp.Dial(addr)
+}
+
+// publicDialTimeout bounds resolving and connecting in publicDial
+const publicDialTimeout = 10 * time.Second
+
+// errNotPublic is returned for hosts that only resolve to internal addresses
+var errNotPublic = errors.New("host does not resolve to a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, internal like RFC 1918
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a routable unicast address, not loopback,
+// private, link-local (cloud metadata lives there), multicast or unspecified
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+// publicIPs resolves host, returning only its public addresses
+func publicIPs(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if isPublicIP(addr.IP) {
+			ips = append(ips, addr.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("%s: %w", host, errNotPublic)
+	}
+	return ips, nil
+}
+
+// publicDial connects only to public addresses, for clients that follow
+// user-supplied URLs. The check runs on the addresses actually dialed, so a
+// DNS answer that changes after validation can't reach internal services.
+func publicDial(addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publicDialTimeout)
+	defer cancel()
+	ips, err := publicIPs(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
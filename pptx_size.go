@@ -0,0 +1,182 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PPTX slide sizes accepted by the slide_size param
+const (
+	SlideSizeAuto       = "auto"
+	SlideSizeStandard   = "4:3"
+	SlideSizeWidescreen = "16:9"
+)
+
+// pptxSlideSizes are PowerPoint's standard slide sizes in EMUs
+var pptxSlideSizes = map[string][2]int64{
+	SlideSizeStandard:   {9144000, 6858000},
+	SlideSizeWidescreen: {12192000, 6858000},
+}
+
+var (
+	pptxSlideSizeTag = regexp.MustCompile(`<p:sldSz\b[^>]*/>`)
+	pptxSlidePart    = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+	pptxPicture      = regexp.MustCompile(`(?s)<p:pic>.*?</p:pic>`)
+	pptxOffset       = regexp.MustCompile(`<a:off x="\d+" y="\d+"/>`)
+	pptxExtent       = regexp.MustCompile(`<a:ext cx="\d+" cy="\d+"/>`)
+)
+
+// resolveSlideSize turns auto into the standard size closest to the first
+// slide's aspect ratio
+func resolveSlideSize(size string, imagePaths []string) string {
+	if size != "" && size != SlideSizeAuto {
+		return size
+	}
+	if len(imagePaths) > 0 {
+		if cfg, err := decodeImageConfig(imagePaths[0]); err == nil && cfg.Height > 0 {
+			if float64(cfg.Width)/float64(cfg.Height) >= (4.0/3.0+16.0/9.0)/2 {
+				return SlideSizeWidescreen
+			}
+		}
+	}
+	return SlideSizeStandard
+}
+
+// resizePPTX rewrites a saved presentation to the given slide size. GoPPT
+// has no way to choose one, so the package XML is patched instead: the
+// sldSz in presentation.xml is replaced and each slide's picture is refitted
+// and centered. Files GoPPT laid out differently are reported, not guessed at.
+func resizePPTX(pptxPath, size string, imagePaths []string) error {
+	dims, ok := pptxSlideSizes[size]
+	if !ok {
+		return fmt.Errorf("unknown slide size %q", size)
+	}
+	slideCX, slideCY := dims[0], dims[1]
+
+	src, err := zip.OpenReader(pptxPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(pptxPath), "slides-*.pptx")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	out := zip.NewWriter(tmpFile)
+	patchedSize := false
+	for _, part := range src.File {
+		var patch func(string) (string, error)
+		if part.Name == "ppt/presentation.xml" {
+			patch = func(xml string) (string, error) {
+				if !pptxSlideSizeTag.MatchString(xml) {
+					return "", fmt.Errorf("presentation.xml has no slide size")
+				}
+				patchedSize = true
+				return pptxSlideSizeTag.ReplaceAllString(xml, fmt.Sprintf(`<p:sldSz cx="%d" cy="%d"/>`, slideCX, slideCY)), nil
+			}
+		} else if m := pptxSlidePart.FindStringSubmatch(part.Name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			if n < 1 || n > len(imagePaths) {
+				return fmt.Errorf("%s has no matching image", part.Name)
+			}
+			cfg, err := decodeImageConfig(imagePaths[n-1])
+			if err != nil {
+				return err
+			}
+			patch = func(xml string) (string, error) {
+				return refitPictures(xml, cfg.Width, cfg.Height, slideCX, slideCY), nil
+			}
+		}
+
+		if patch == nil {
+			if err := copyZipPart(out, part); err != nil {
+				out.Close()
+				return err
+			}
+			continue
+		}
+		if err := patchZipPart(out, part, patch); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if !patchedSize {
+		return fmt.Errorf("presentation.xml not found")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), pptxPath)
+}
+
+// refitPictures scales every picture on a slide to fit it, keeping the image's
+// aspect ratio, and centers it
+func refitPictures(xml string, imgWidth, imgHeight int, slideCX, slideCY int64) string {
+	if imgWidth <= 0 || imgHeight <= 0 {
+		return xml
+	}
+	cx, cy := slideCX, slideCX*int64(imgHeight)/int64(imgWidth)
+	if cy > slideCY {
+		cx, cy = slideCY*int64(imgWidth)/int64(imgHeight), slideCY
+	}
+	offset := fmt.Sprintf(`<a:off x="%d" y="%d"/>`, (slideCX-cx)/2, (slideCY-cy)/2)
+	extent := fmt.Sprintf(`<a:ext cx="%d" cy="%d"/>`, cx, cy)
+
+	return pptxPicture.ReplaceAllStringFunc(xml, func(pic string) string {
+		pic = pptxOffset.ReplaceAllLiteralString(pic, offset)
+		return pptxExtent.ReplaceAllLiteralString(pic, extent)
+	})
+}
+
+// copyZipPart copies a part into out without recompressing it
+func copyZipPart(out *zip.Writer, part *zip.File) error {
+	r, err := part.OpenRaw()
+	if err != nil {
+		return err
+	}
+	w, err := out.CreateRaw(&part.FileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// patchZipPart rewrites a text part through patch
+func patchZipPart(out *zip.Writer, part *zip.File, patch func(string) (string, error)) error {
+	r, err := part.Open()
+	if err != nil {
+		return err
+	}
+	var content strings.Builder
+	_, err = io.Copy(&content, r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	patched, err := patch(content.String())
+	if err != nil {
+		return err
+	}
+
+	w, err := out.CreateHeader(&zip.FileHeader{Name: part.Name, Method: zip.Deflate, Modified: part.Modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, patched)
+	return err
+}
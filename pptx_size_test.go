@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePPTXFixture saves a package laid out like GoPPT's output: a 4:3
+// presentation.xml and one full-slide picture per image
+func writePPTXFixture(t *testing.T, dir string, slides int) string {
+	t.Helper()
+	pptxPath := filepath.Join(dir, "fixture.pptx")
+	f, err := os.Create(pptxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	parts := map[string]string{
+		"ppt/presentation.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:sldSz cx="9144000" cy="6858000" type="screen4x3"/><p:notesSz cx="6858000" cy="9144000"/></p:presentation>`,
+	}
+	for i := 1; i <= slides; i++ {
+		parts[fmt.Sprintf("ppt/slides/slide%d.xml", i)] = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<p:sld xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"><p:cSld><p:spTree><p:pic><p:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="9144000" cy="6858000"/></a:xfrm></p:spPr></p:pic></p:spTree></p:cSld></p:sld>`
+	}
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return pptxPath
+}
+
+// readZipXML decodes one part of a zip package into v
+func readZipXML(t *testing.T, zr *zip.ReadCloser, name string, v interface{}) {
+	t.Helper()
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		if err := xml.NewDecoder(r).Decode(v); err != nil {
+			t.Fatalf("%s does not parse: %v", name, err)
+		}
+		return
+	}
+	t.Fatalf("package has no %s", name)
+}
+
+func TestResizePPTX(t *testing.T) {
+	tests := []struct {
+		name          string
+		slideSize     string
+		width, height int
+		wantCX        int64
+		wantCY        int64
+	}{
+		{name: "auto picks 16:9 for a wide slide", slideSize: SlideSizeAuto, width: 1600, height: 900, wantCX: 12192000, wantCY: 6858000},
+		{name: "auto picks 4:3 for a standard slide", slideSize: SlideSizeAuto, width: 400, height: 300, wantCX: 9144000, wantCY: 6858000},
+		{name: "explicit 4:3 letterboxes a wide slide", slideSize: SlideSizeStandard, width: 1600, height: 900, wantCX: 9144000, wantCY: 6858000},
+		{name: "explicit 16:9 pillarboxes a tall slide", slideSize: SlideSizeWidescreen, width: 300, height: 600, wantCX: 12192000, wantCY: 6858000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			imagePaths := []string{writeSlideJPEG(t, dir, tt.width, tt.height), writeSlideJPEG(t, dir, tt.width, tt.height)}
+			pptxPath := writePPTXFixture(t, dir, len(imagePaths))
+
+			size := resolveSlideSize(tt.slideSize, imagePaths)
+			if err := resizePPTX(pptxPath, size, imagePaths); err != nil {
+				t.Fatal(err)
+			}
+
+			zr, err := zip.OpenReader(pptxPath)
+			if err != nil {
+				t.Fatalf("resized pptx is not a zip: %v", err)
+			}
+			defer zr.Close()
+
+			var presentation struct {
+				SlideSize struct {
+					CX int64 `xml:"cx,attr"`
+					CY int64 `xml:"cy,attr"`
+				} `xml:"sldSz"`
+			}
+			readZipXML(t, zr, "ppt/presentation.xml", &presentation)
+			if presentation.SlideSize.CX != tt.wantCX || presentation.SlideSize.CY != tt.wantCY {
+				t.Fatalf("sldSz is %dx%d, want %dx%d", presentation.SlideSize.CX, presentation.SlideSize.CY, tt.wantCX, tt.wantCY)
+			}
+
+			wantRatio := float64(tt.width) / float64(tt.height)
+			for i := range imagePaths {
+				var slide struct {
+					Pictures []struct {
+						Offset struct {
+							X int64 `xml:"x,attr"`
+							Y int64 `xml:"y,attr"`
+						} `xml:"spPr>xfrm>off"`
+						Extent struct {
+							CX int64 `xml:"cx,attr"`
+							CY int64 `xml:"cy,attr"`
+						} `xml:"spPr>xfrm>ext"`
+					} `xml:"cSld>spTree>pic"`
+				}
+				readZipXML(t, zr, fmt.Sprintf("ppt/slides/slide%d.xml", i+1), &slide)
+				if len(slide.Pictures) != 1 {
+					t.Fatalf("slide %d has %d pictures, want 1", i+1, len(slide.Pictures))
+				}
+				pic := slide.Pictures[0]
+				if pic.Extent.CX > tt.wantCX || pic.Extent.CY > tt.wantCY {
+					t.Errorf("slide %d picture is %dx%d, larger than the %dx%d slide", i+1, pic.Extent.CX, pic.Extent.CY, tt.wantCX, tt.wantCY)
+				}
+				ratio := float64(pic.Extent.CX) / float64(pic.Extent.CY)
+				if diff := ratio - wantRatio; diff > 0.01 || diff < -0.01 {
+					t.Errorf("slide %d picture has aspect ratio %.3f, want %.3f", i+1, ratio, wantRatio)
+				}
+				if wantX, wantY := (tt.wantCX-pic.Extent.CX)/2, (tt.wantCY-pic.Extent.CY)/2; pic.Offset.X != wantX || pic.Offset.Y != wantY {
+					t.Errorf("slide %d picture is at (%d, %d), want centred at (%d, %d)", i+1, pic.Offset.X, pic.Offset.Y, wantX, wantY)
+				}
+			}
+		})
+	}
+}
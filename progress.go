@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"io"
+)
+
+// Conversion phases reported through ConversionOptions.Progress
+const (
+	PhaseFetching   = "fetching"
+	PhaseConverting = "converting"
+	PhaseUploading  = "uploading"
+)
+
+// progressFunc receives the current phase and how many of the deck's slides
+// have been downloaded. It may be called from several goroutines at once.
+type progressFunc func(phase string, done, total int)
+
+// reportProgress forwards to opts.Progress when one is set
+func (o ConversionOptions) reportProgress(phase string, done, total int) {
+	if o.Progress != nil {
+		o.Progress(phase, done, total)
+	}
+}
+
+// Share of the job's progress percentage reached when each phase starts.
+// Downloads dominate a conversion, so fetching spans most of the range.
+const (
+	fetchingShare   = 90
+	convertingShare = 90
+	uploadingShare  = 95
+)
+
+// progressPercent maps a phase and download count to 0-100
+func progressPercent(phase string, done, total int) int {
+	switch phase {
+	case PhaseFetching:
+		if total == 0 {
+			return 0
+		}
+		return fetchingShare * done / total
+	case PhaseConverting:
+		return convertingShare
+	case PhaseUploading:
+		return uploadingShare
+	default:
+		return 0
+	}
+}
+
+// progressStorage reports the uploading phase before handing files to store
+type progressStorage struct {
+	Storage
+	opts  ConversionOptions
+	total int
+}
+
+func (s progressStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	s.opts.reportProgress(PhaseUploading, s.total, s.total)
+	return s.Storage.Upload(ctx, localPath, remotePath)
+}
+
+// progressStreamStorage is a progressStorage for backends that stream uploads
+type progressStreamStorage struct {
+	progressStorage
+	streamer streamUploader
+}
+
+func (s progressStreamStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	s.opts.reportProgress(PhaseUploading, s.total, s.total)
+	return s.streamer.UploadStream(ctx, r, remotePath)
+}
+
+// withProgress wraps store so uploads report progress, keeping its
+// streaming support. Without a Progress callback store is returned as-is.
+func (o ConversionOptions) withProgress(store Storage, total int) Storage {
+	if o.Progress == nil {
+		return store
+	}
+	wrapped := progressStorage{Storage: store, opts: o, total: total}
+	if streamer, ok := store.(streamUploader); ok {
+		return progressStreamStorage{progressStorage: wrapped, streamer: streamer}
+	}
+	return wrapped
+}
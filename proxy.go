@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// defaultProxyAllowedHosts lists SlideShare's image CDNs when PROXY_ALLOWED_HOSTS is unset
+	defaultProxyAllowedHosts = "image.slidesharecdn.com,cdn.slidesharecdn.com"
+	// defaultProxyRateLimit is requests per minute per client IP when PROXY_RATE_LIMIT is unset
+	defaultProxyRateLimit = 120
+	// proxyMaxBodySize caps proxied images so the endpoint can't be used to pull huge files
+	proxyMaxBodySize = 20 << 20
+	proxyUserAgent   = "Mozilla/5.0 (compatible; golang-ssdl/1.0)"
+	proxyCacheMaxAge = 24 * time.Hour
+)
+
+var proxyClient = &fasthttp.Client{MaxResponseBodySize: proxyMaxBodySize, Dial: outboundDial}
+
+// proxyAllowedHosts returns the exact hostnames /proxy may fetch from
+func proxyAllowedHosts() map[string]bool {
+	hosts := os.Getenv("PROXY_ALLOWED_HOSTS")
+	if strings.TrimSpace(hosts) == "" {
+		hosts = defaultProxyAllowedHosts
+	}
+
+	allowed := make(map[string]bool)
+	for _, host := range strings.Split(hosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowed[host] = true
+		}
+	}
+	return allowed
+}
+
+// validateProxySource only accepts plain https URLs on an allowlisted host,
+// without credentials or explicit ports, to keep /proxy from reaching
+// internal services
+func validateProxySource(src string) (*url.URL, error) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" || u.Opaque != "" {
+		return nil, &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Invalid src URL"}
+	}
+	if !proxyAllowedHosts()[strings.ToLower(u.Hostname())] {
+		return nil, &CustomAPIError{StatusCode: 403, Code: CodeHostNotAllowed, Detail: "src host is not allowed"}
+	}
+	return u, nil
+}
+
+// proxyRateLimiter limits /proxy per client IP using PROXY_RATE_LIMIT requests per minute
+func proxyRateLimiter() fiber.Handler {
+	max := defaultProxyRateLimit
+	if v, err := strconv.Atoi(os.Getenv("PROXY_RATE_LIMIT")); err == nil && v > 0 {
+		max = v
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: time.Minute,
+		LimitReached: func(c *fiber.Ctx) error {
+			return &CustomAPIError{StatusCode: fiber.StatusTooManyRequests, Code: CodeRateLimited, Detail: "Too many proxy requests", RetryAfter: 60}
+		},
+	})
+}
+
+func proxyHandler(c *fiber.Ctx) error {
+	src, err := validateProxySource(c.Query("src"))
+	if err != nil {
+		return err
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(src.String())
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.Header.SetUserAgent(proxyUserAgent)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	// Redirects are not followed so the allowlist can't be bypassed
+	if err := doHostLimited(c.UserContext(), proxyClient, req, resp, 20*time.Second); err != nil {
+		return &CustomAPIError{StatusCode: 502, Code: CodeFetchFailed, Detail: "Failed to fetch image"}
+	}
+
+	if resp.StatusCode() == fasthttp.StatusTooManyRequests {
+		return rateLimitedError(resp)
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return &CustomAPIError{StatusCode: 502, Code: CodeFetchFailed, Detail: fmt.Sprintf("Upstream returned status %d", resp.StatusCode())}
+	}
+
+	contentType := string(resp.Header.ContentType())
+	if !strings.HasPrefix(contentType, "image/") {
+		return &CustomAPIError{StatusCode: 502, Code: CodeFetchFailed, Detail: "Upstream did not return an image"}
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(proxyCacheMaxAge.Seconds())))
+	if etag := resp.Header.Peek(fiber.HeaderETag); len(etag) > 0 {
+		c.Set(fiber.HeaderETag, string(etag))
+	}
+	if lastModified := resp.Header.Peek(fiber.HeaderLastModified); len(lastModified) > 0 {
+		c.Set(fiber.HeaderLastModified, string(lastModified))
+	}
+
+	// Copy the body, resp's buffer goes back to the pool before fiber replies
+	c.Response().SetBody(resp.Body())
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+func TestProxyHandler(t *testing.T) {
+	image := bytes.Repeat([]byte{0xff, 0xd8, 0x42}, 64<<10)
+
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slide.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write(image)
+		case "/numbered.jpg":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write(bytes.Repeat([]byte(r.URL.Query().Get("n")), 16<<10))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		case "/busy.jpg":
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	// Send every proxied request to the test server, whatever its host
+	saved := proxyClient
+	proxyClient = &fasthttp.Client{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Dial: func(string) (net.Conn, error) {
+			return net.Dial("tcp", upstream.Listener.Addr().String())
+		},
+	}
+	defer func() { proxyClient = saved }()
+	t.Setenv("PROXY_ALLOWED_HOSTS", "image.slidesharecdn.com")
+
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/proxy", proxyHandler)
+
+	const cdn = "https://image.slidesharecdn.com"
+	tests := []struct {
+		name       string
+		src        string
+		wantStatus int
+		wantCode   string
+		wantBody   []byte
+	}{
+		{name: "image is passed through", src: cdn + "/slide.jpg", wantStatus: 200, wantBody: image},
+		{name: "non-image upstream", src: cdn + "/page.html", wantStatus: 502, wantCode: CodeFetchFailed},
+		{name: "missing upstream", src: cdn + "/gone.jpg", wantStatus: 502, wantCode: CodeFetchFailed},
+		{name: "rate-limited upstream", src: cdn + "/busy.jpg", wantStatus: 429, wantCode: CodeRateLimited},
+		{name: "host not allowed", src: "https://example.com/slide.jpg", wantStatus: 403, wantCode: CodeHostNotAllowed},
+		{name: "plain http", src: "http://image.slidesharecdn.com/slide.jpg", wantStatus: 400, wantCode: CodeInvalidURL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", "/proxy?src="+tt.src, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantBody != nil {
+				if !bytes.Equal(body, tt.wantBody) {
+					t.Errorf("body is %d bytes, want the %d byte upstream image", len(body), len(tt.wantBody))
+				}
+				if got := resp.Header.Get(fiber.HeaderETag); got != `"v1"` {
+					t.Errorf("ETag = %q, want %q", got, `"v1"`)
+				}
+				return
+			}
+
+			var apiErr struct {
+				Code string `json:"code"`
+			}
+			if err := json.Unmarshal(body, &apiErr); err != nil {
+				t.Fatal(err)
+			}
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.wantCode)
+			}
+		})
+	}
+
+	// Each reply must carry its own upstream body even while other requests
+	// reuse the pooled upstream responses
+	t.Run("concurrent bodies stay separate", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 32; i++ {
+			wg.Add(1)
+			go func(n string) {
+				defer wg.Done()
+				resp, err := app.Test(httptest.NewRequest("GET", "/proxy?src="+cdn+"/numbered.jpg?n="+n, nil), -1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if want := bytes.Repeat([]byte(n), 16<<10); !bytes.Equal(body, want) {
+					t.Errorf("request %s got another request's body", n)
+				}
+			}(strconv.Itoa(i % 10))
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultShutdownTimeout applies when SHUTDOWN_TIMEOUT is unset
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownTimeout reads how long shutdown waits for in-flight work from SHUTDOWN_TIMEOUT (e.g. "1m")
+func shutdownTimeout() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil && d > 0 {
+		return d
+	}
+	return defaultShutdownTimeout
+}
+
+// shutdown stops accepting connections, waits for in-flight requests and
+// background jobs to finish within timeout, then removes leftover temp files
+// when TMP_SWEEP is on. Work still running at the deadline is cancelled.
+func shutdown(app *fiber.App, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	serverErr := app.ShutdownWithContext(ctx)
+	jobsErr := stopJobWorkers(ctx)
+
+	// With everything drained, what is left belongs to work that was cut off.
+	// Requests still running past the deadline may hold their files, those
+	// wait for the next startup sweep.
+	if tempSweep && serverErr == nil && jobsErr == nil {
+		removeTempFiles(0)
+	}
+
+	// Export the spans of the work that just finished
+	tracingErr := shutdownTracing(ctx)
+
+	return errors.Join(serverErr, jobsErr, tracingErr)
+}
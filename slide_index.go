@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// slideIndexEntry describes one slide in <docshort>.index.json
+type slideIndexEntry struct {
+	Slide      int    `json:"slide"`
+	Source     string `json:"source"`
+	Resolution int    `json:"resolution"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+}
+
+// buildSlideIndex lists the selected images in slide order with the srcset
+// width they were picked at and their decoded dimensions. Slides are numbered
+// from firstSlide, the deck number of selected[0], so filtered slides leave gaps.
+func buildSlideIndex(slides []map[int]string, selected []string, firstSlide int, stats *ConversionStats) []slideIndexEntry {
+	resolutions := slideResolutions(slides)
+
+	var index []slideIndexEntry
+	for i, url := range selected {
+		if stats.isFiltered(url) {
+			continue
+		}
+		entry := slideIndexEntry{Slide: firstSlide + i, Source: url, Resolution: resolutions[url]}
+		if dims, ok := stats.dimensions(url); ok {
+			entry.Width, entry.Height = dims.X, dims.Y
+		}
+		index = append(index, entry)
+	}
+	return index
+}
+
+// slideResolutions maps every srcset URL of every slide to its width
+func slideResolutions(slides []map[int]string) map[string]int {
+	resolutions := make(map[string]int)
+	for _, slide := range slides {
+		for width, url := range slide {
+			resolutions[url] = width
+		}
+	}
+	return resolutions
+}
+
+// uploadSlideIndex writes the index to remotePath, next to the main output,
+// and returns its download URL
+func uploadSlideIndex(ctx context.Context, store Storage, index []slideIndexEntry, title, remotePath string) (string, error) {
+	tmpIndex, err := os.CreateTemp(tempDir, "slides-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpIndex.Name())
+
+	err = json.NewEncoder(tmpIndex).Encode(map[string]interface{}{
+		"title":       title,
+		"slide_count": len(index),
+		"slides":      index,
+	})
+	tmpIndex.Close()
+	if err != nil {
+		return "", err
+	}
+
+	indexURL, _, err := store.Upload(ctx, tmpIndex.Name(), remotePath)
+	if err != nil {
+		return "", &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+	return indexURL, nil
+}
@@ -4,72 +4,263 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
-	_ "image/gif"
-	"image/jpeg"
+	"image/color"
+	"image/draw"
+	"image/gif"
 	_ "image/png"
 	"io"
 	"math"
-
+	"math/rand"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/disintegration/imaging"
-	"github.com/jlaffaye/ftp"
 	"github.com/jung-kurt/gofpdf"
 	"github.com/manuviswam/GoPPT/ppt"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	_ "golang.org/x/image/webp"
 	"golang.org/x/sync/semaphore"
 )
 
-// ValidateURL checks if the URL is a valid SlideShare URL
-func ValidateURL(urlStr string) error {
+// defaultMaxConcurrentParses bounds HTML parsing when MAX_CONCURRENT_PARSES is unset
+const defaultMaxConcurrentParses = 4
+
+var (
+	parseSemOnce sync.Once
+	parseSem     *semaphore.Weighted
+)
+
+// parseSemaphore returns the process-wide limiter for goquery parsing.
+// It is separate from the image download concurrency.
+func parseSemaphore() *semaphore.Weighted {
+	parseSemOnce.Do(func() {
+		limit := int64(defaultMaxConcurrentParses)
+		if v, err := strconv.ParseInt(os.Getenv("MAX_CONCURRENT_PARSES"), 10, 64); err == nil && v > 0 {
+			limit = v
+		}
+		parseSem = semaphore.NewWeighted(limit)
+	})
+	return parseSem
+}
+
+const (
+	// defaultUserAgent is sent to SlideShare when USER_AGENT is unset
+	defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	acceptHTML       = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	acceptImage      = "image/avif,image/webp,image/apng,image/*,*/*;q=0.8"
+)
+
+// setBrowserHeaders makes requests to SlideShare look like a regular browser.
+// The User-Agent can be rotated through USER_AGENT when one gets blocked.
+func setBrowserHeaders(req *fasthttp.Request, accept string) {
+	userAgent := strings.TrimSpace(os.Getenv("USER_AGENT"))
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.SetUserAgent(userAgent)
+	req.Header.Set(fasthttp.HeaderAccept, accept)
+	req.Header.Set(fasthttp.HeaderAcceptLanguage, "en-US,en;q=0.9")
+}
+
+// slideshareHosts are the hosts accepted in deck URLs, all served by www.slideshare.net
+var slideshareHosts = map[string]bool{
+	"slideshare.net":     true,
+	"www.slideshare.net": true,
+	"m.slideshare.net":   true,
+}
+
+// NormalizeURL checks if the URL is a valid SlideShare URL and returns it in
+// canonical form: https on www.slideshare.net with query and fragment dropped.
+// Links pasted without a scheme are accepted.
+func NormalizeURL(urlStr string) (string, error) {
+	urlStr = strings.TrimSpace(urlStr)
+
+	// Refuse file:, data:, javascript: and other schemes outright instead of
+	// relying on the https-prefixed reparse below to fail
+	if u, err := url.Parse(urlStr); err == nil && u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Only http and https SlideShare URLs are supported"}
+	}
+	if !strings.Contains(urlStr, "://") {
+		urlStr = "https://" + urlStr
+	}
+
 	u, err := url.Parse(urlStr)
 	if err != nil {
-		return &CustomAPIError{StatusCode: 400, Detail: "Invalid URL"}
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Invalid URL"}
 	}
 
-	if u.Host != "www.slideshare.net" {
-		return &CustomAPIError{StatusCode: 400, Detail: "Invalid SlideShare URL"}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Port() != "" || !slideshareHosts[strings.ToLower(u.Hostname())] {
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Invalid SlideShare URL"}
 	}
 
-	return nil
+	canonical := url.URL{Scheme: "https", Host: "www.slideshare.net", Path: u.Path}
+	return canonical.String(), nil
+}
+
+// ResolveDeckURL resolves a numeric SlideShare deck ID to its canonical URL.
+//
+// SlideShare serves an embed page for every deck at /slideshow/embed_code/<id>.
+// That page is fetched and its canonical link (or og:url as a fallback) names
+// the public deck URL, which then goes through the regular URL pipeline.
+func ResolveDeckURL(ctx context.Context, client *fasthttp.Client, id string) (string, error) {
+	if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidParams, Detail: "Invalid deck id"}
+	}
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI("https://www.slideshare.net/slideshow/embed_code/" + id)
+	req.Header.SetMethod(fasthttp.MethodGet)
+	setBrowserHeaders(req, acceptHTML)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	// Follow up to five redirects, every hop cancellable and host-limited
+	for redirects := 0; ; redirects++ {
+		err := doHostLimited(ctx, client, req, resp, 0)
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if err != nil {
+			return "", &CustomAPIError{StatusCode: 500, Code: CodeFetchFailed, Detail: "Failed to resolve deck id"}
+		}
+
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) || len(location) == 0 {
+			break
+		}
+		if redirects == 5 {
+			return "", &CustomAPIError{StatusCode: 500, Code: CodeFetchFailed, Detail: "Failed to resolve deck id: too many redirects"}
+		}
+		req.URI().UpdateBytes(location)
+	}
+
+	if resp.StatusCode() == fasthttp.StatusTooManyRequests {
+		return "", rateLimitedError(resp)
+	}
+	if resp.StatusCode() == fasthttp.StatusNotFound {
+		return "", &CustomAPIError{StatusCode: 404, Code: CodeDeckNotFound, Detail: "Deck not found"}
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return "", &CustomAPIError{StatusCode: resp.StatusCode(), Code: CodeFetchFailed, Detail: "Failed to resolve deck id"}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body()))
+	if err != nil {
+		return "", &CustomAPIError{StatusCode: 500, Code: CodeParseFailed, Detail: "Failed to parse HTML"}
+	}
+
+	deckURL := doc.Find("link[rel='canonical']").AttrOr("href", "")
+	if deckURL == "" || strings.Contains(deckURL, "/embed_code/") {
+		deckURL = doc.Find("meta[property='og:url']").AttrOr("content", "")
+	}
+	if deckURL == "" || strings.Contains(deckURL, "/embed_code/") {
+		return "", &CustomAPIError{StatusCode: 404, Code: CodeDeckNotFound, Detail: "Deck not found"}
+	}
+
+	return deckURL, nil
 }
 
 // FetchSlideImages fetches all slide images from a SlideShare URL
-func FetchSlideImages(urlStr string) (map[string]interface{}, error) {
+func FetchSlideImages(ctx context.Context, client *fasthttp.Client, urlStr string) (map[string]interface{}, error) {
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	req.SetRequestURI(urlStr)
 	req.Header.SetMethod(fasthttp.MethodGet)
+	setBrowserHeaders(req, acceptHTML)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	client := &fasthttp.Client{}
-	if err := client.Do(req, resp); err != nil {
-		return nil, &CustomAPIError{StatusCode: 500, Detail: "Failed to fetch the presentation page"}
+	err := doHostLimited(ctx, client, req, resp, 0)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeFetchFailed, Detail: "Failed to fetch the presentation page"}
+	}
+
+	if resp.StatusCode() == fasthttp.StatusTooManyRequests {
+		return nil, rateLimitedError(resp)
 	}
 
 	if resp.StatusCode() != fasthttp.StatusOK {
-		return nil, &CustomAPIError{StatusCode: resp.StatusCode(), Detail: "Failed to fetch the presentation page"}
+		return nil, &CustomAPIError{StatusCode: resp.StatusCode(), Code: CodeFetchFailed, Detail: "Failed to fetch the presentation page"}
 	}
 
+	// Bound concurrent parses, goquery is CPU-heavy on large pages
+	sem := parseSemaphore()
+	if err := sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer sem.Release(1)
+
 	body := resp.Body()
 	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		return nil, &CustomAPIError{StatusCode: 500, Detail: "Failed to parse HTML"}
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeParseFailed, Detail: "Failed to parse HTML"}
 	}
 
 	title := doc.Find("title").Text()
+	metadata := extractDeckMetadata(doc)
+	author, _ := metadata["author"].(string)
+
+	allSlideImages := extractSlideImages(ctx, doc, urlStr)
+
+	// Lazy-loading pages only describe their slides in embedded JSON
+	if len(allSlideImages) == 0 {
+		allSlideImages = extractNextDataSlides(ctx, doc, urlStr)
+	}
+
+	// Some decks only render slides client-side, retry through the render service
+	if len(allSlideImages) == 0 {
+		renderServiceURL := os.Getenv("RENDER_SERVICE_URL")
+		if renderServiceURL == "" {
+			return nil, &CustomAPIError{
+				StatusCode: 404,
+				Code:       CodeNoSlidesFound,
+				Detail:     "No slide images found in the static page and the JavaScript rendering fallback is disabled",
+			}
+		}
+
+		renderedDoc, err := fetchRenderedPage(ctx, renderServiceURL, urlStr)
+		if err != nil {
+			return nil, err
+		}
+		allSlideImages = extractSlideImages(ctx, renderedDoc, urlStr)
+	}
+
+	if len(allSlideImages) == 0 {
+		return nil, &CustomAPIError{StatusCode: 404, Code: CodeNoSlidesFound, Detail: "No slide images found"}
+	}
+
+	return map[string]interface{}{
+		"title":    title,
+		"author":   author,
+		"metadata": metadata,
+		"slides":   allSlideImages,
+	}, nil
+}
+
+// extractSlideImages collects the srcset resolutions of every slide image in doc
+func extractSlideImages(ctx context.Context, doc *goquery.Document, urlStr string) []map[int]string {
+	firstWins := srcsetFirstWins()
 
 	var allSlideImages []map[int]string
 	doc.Find("img[data-testid='vertical-slide-image']").Each(func(i int, s *goquery.Selection) {
@@ -78,228 +269,975 @@ func FetchSlideImages(urlStr string) (map[string]interface{}, error) {
 			return
 		}
 
-		slideResolutions := make(map[int]string)
-		sources := strings.Split(srcset, ",")
-		for _, src := range sources {
-			parts := strings.Fields(strings.TrimSpace(src))
-			if len(parts) == 2 {
-				urlPart := parts[0]
-				res := parts[1]
-				if strings.HasSuffix(res, "w") {
-					resolution, err := strconv.Atoi(res[:len(res)-1])
-					if err == nil {
-						slideResolutions[resolution] = urlPart
-					}
-				}
-			}
+		slideResolutions, duplicates := parseSrcset(srcset, firstWins)
+		if len(duplicates) > 0 {
+			loggerFrom(ctx).Warn("duplicate srcset widths", "slide", i+1, "widths", duplicates, "url", urlStr)
 		}
 
 		if len(slideResolutions) > 0 {
 			allSlideImages = append(allSlideImages, slideResolutions)
 		}
 	})
+	return allSlideImages
+}
 
-	if len(allSlideImages) == 0 {
-		return nil, &CustomAPIError{StatusCode: 404, Detail: "No slide images found"}
+// fetchRenderedPage asks the headless rendering service configured in
+// RENDER_SERVICE_URL for the JavaScript-rendered HTML of urlStr. The service
+// is called as GET <RENDER_SERVICE_URL>?url=<deck url> and must return HTML.
+func fetchRenderedPage(ctx context.Context, renderServiceURL, urlStr string) (*goquery.Document, error) {
+	renderURL, err := url.Parse(renderServiceURL)
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeConfigError, Detail: "Invalid RENDER_SERVICE_URL"}
 	}
+	query := renderURL.Query()
+	query.Set("url", urlStr)
+	renderURL.RawQuery = query.Encode()
 
-	return map[string]interface{}{
-		"title":  title,
-		"slides": allSlideImages,
-	}, nil
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(renderURL.String())
+	req.Header.SetMethod(fasthttp.MethodGet)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	client := &fasthttp.Client{}
+	if err := doWithContext(ctx, client, req, resp, 60*time.Second); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &CustomAPIError{StatusCode: 502, Code: CodeFetchFailed, Detail: "Failed to render the presentation page"}
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, &CustomAPIError{StatusCode: 502, Code: CodeFetchFailed, Detail: fmt.Sprintf("Render service returned status %d", resp.StatusCode())}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body()))
+	if err != nil {
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeParseFailed, Detail: "Failed to parse HTML"}
+	}
+	return doc, nil
 }
-func fetchImage(ctx context.Context, client *fasthttp.Client, urlStr string) (string, error) {
+
+// srcsetFirstWins reports whether SRCSET_DUPLICATES=first is configured.
+// The default ("last") keeps the last URL listed for a repeated width.
+func srcsetFirstWins() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("SRCSET_DUPLICATES")), "first")
+}
+
+// parseSrcset maps each "<url> <width>w" candidate to its width. When a width
+// repeats, firstWins decides which URL is kept; repeated widths are returned.
+func parseSrcset(srcset string, firstWins bool) (map[int]string, []int) {
+	slideResolutions := make(map[int]string)
+	var duplicates []int
+
+	sources := strings.Split(srcset, ",")
+	for _, src := range sources {
+		parts := strings.Fields(strings.TrimSpace(src))
+		if len(parts) == 2 {
+			urlPart := parts[0]
+			res := parts[1]
+			if strings.HasSuffix(res, "w") {
+				resolution, err := strconv.Atoi(res[:len(res)-1])
+				if err == nil {
+					if _, seen := slideResolutions[resolution]; seen {
+						duplicates = append(duplicates, resolution)
+						if firstWins {
+							continue
+						}
+					}
+					slideResolutions[resolution] = urlPart
+				}
+			}
+		}
+	}
+
+	return slideResolutions, duplicates
+}
+
+// defaultRetryAfter is used when SlideShare sends 429 without a usable Retry-After
+const defaultRetryAfter = 30
+
+// retryAfterSeconds parses an upstream Retry-After header (seconds or HTTP date)
+func retryAfterSeconds(resp *fasthttp.Response) (int, bool) {
+	value := strings.TrimSpace(string(resp.Header.Peek(fasthttp.HeaderRetryAfter)))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return secs, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if secs := int(math.Ceil(time.Until(at).Seconds())); secs > 0 {
+			return secs, true
+		}
+	}
+	return 0, false
+}
+
+// rateLimitedError turns an upstream 429 into a client-facing error that
+// carries SlideShare's Retry-After (seconds or HTTP date)
+func rateLimitedError(resp *fasthttp.Response) *CustomAPIError {
+	retryAfter := defaultRetryAfter
+	if secs, ok := retryAfterSeconds(resp); ok {
+		retryAfter = secs
+	}
+
+	return &CustomAPIError{
+		StatusCode: 429,
+		Code:       CodeRateLimited,
+		Detail:     fmt.Sprintf("SlideShare is rate limiting requests, retry after %d seconds", retryAfter),
+		RetryAfter: retryAfter,
+	}
+}
+
+const (
+	// defaultFetchMaxAttempts applies when FETCH_MAX_ATTEMPTS is unset
+	defaultFetchMaxAttempts = 3
+	fetchBackoffBase        = 500 * time.Millisecond
+	fetchBackoffMax         = 10 * time.Second
+)
+
+// fetchMaxAttempts reads how many times an image download is tried from FETCH_MAX_ATTEMPTS
+func fetchMaxAttempts() int {
+	if v, err := strconv.Atoi(os.Getenv("FETCH_MAX_ATTEMPTS")); err == nil && v > 0 {
+		return v
+	}
+	return defaultFetchMaxAttempts
+}
+
+// retryDelay returns the wait before the next attempt: Retry-After when the
+// upstream sent one, otherwise exponential backoff with full jitter
+func retryDelay(attempt int, resp *fasthttp.Response) time.Duration {
+	if resp != nil {
+		if secs, ok := retryAfterSeconds(resp); ok {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	backoff := fetchBackoffBase << (attempt - 1)
+	if backoff <= 0 || backoff > fetchBackoffMax {
+		backoff = fetchBackoffMax
+	}
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// doImageRequest performs req, retrying network errors, 5xx and 429 responses
+// up to FETCH_MAX_ATTEMPTS times, each attempt bounded by timeout. The last
+// response is left in resp; retries stop early when the wait would outlast ctx.
+func doImageRequest(ctx context.Context, client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, urlStr string, timeout time.Duration) error {
+	maxAttempts := fetchMaxAttempts()
+	for attempt := 1; ; attempt++ {
+		// Wait for a per-host slot shared with all other conversions
+		err := doHostLimited(ctx, client, req, resp, timeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// The same image would only be rejected again
+		if errors.Is(err, fasthttp.ErrBodyTooLarge) {
+			return err
+		}
+
+		retryable := err != nil || resp.StatusCode() == fasthttp.StatusTooManyRequests || resp.StatusCode() >= 500
+		if !retryable || attempt >= maxAttempts {
+			return err
+		}
+
+		var delay time.Duration
+		if err == nil {
+			delay = retryDelay(attempt, resp)
+		} else {
+			delay = retryDelay(attempt, nil)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// doWithContext performs the request until it completes, timeout passes or
+// ctx is done, whichever comes first. A timeout of zero leaves only ctx's
+// deadline. fasthttp has no context support, so the request runs on copies
+// of req and resp that are abandoned to finish in the background when ctx
+// ends first, leaving the caller free to release the originals.
+func doWithContext(ctx context.Context, client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	return doRequest(ctx, client, req, resp, timeout, nil)
+}
+
+// doHostLimited is doWithContext holding a MAX_HOST_CONCURRENCY slot for
+// req's host. The slot is kept until the request really finishes, also when
+// ctx abandons it first, so cancelled requests still count against the host.
+func doHostLimited(ctx context.Context, client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	release, err := sharedHostLimiter().acquire(ctx, req.URI().String())
+	if err != nil {
+		return err
+	}
+	return doRequest(ctx, client, req, resp, timeout, release)
+}
+
+// doRequest implements doWithContext, calling finished, when set, once the
+// request is over, which may be after doRequest returned
+func doRequest(ctx context.Context, client *fasthttp.Client, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration, finished func()) error {
+	if err := ctx.Err(); err != nil {
+		if finished != nil {
+			finished()
+		}
+		return err
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	ctxDeadline := false
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+		ctxDeadline = true
+	}
+
+	reqCopy := fasthttp.AcquireRequest()
+	req.CopyTo(reqCopy)
+	respCopy := fasthttp.AcquireResponse()
+	respCopy.SkipBody = resp.SkipBody
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		if deadline.IsZero() {
+			err = client.Do(reqCopy, respCopy)
+		} else {
+			err = client.DoDeadline(reqCopy, respCopy, deadline)
+		}
+		if finished != nil {
+			finished()
+		}
+		done <- err
+	}()
+
+	release := func() {
+		fasthttp.ReleaseRequest(reqCopy)
+		fasthttp.ReleaseResponse(respCopy)
+	}
+	select {
+	case err := <-done:
+		respCopy.CopyTo(resp)
+		release()
+		// Hitting ctx's deadline inside fasthttp reports its own timeout error,
+		// possibly a moment before ctx itself expires
+		if errors.Is(err, fasthttp.ErrTimeout) && ctxDeadline {
+			<-ctx.Done()
+		}
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+			return ctxErr
+		}
+		return err
+	case <-ctx.Done():
+		go func() {
+			<-done
+			release()
+		}()
+		return ctx.Err()
+	}
+}
+
+// errSlideFiltered is returned by fetchImage for images outside the slide bounds
+var errSlideFiltered = errors.New("image is not slide-shaped")
+
+// slideFilter holds the dimension and aspect ratio bounds for real slides
+type slideFilter struct {
+	minDimension int
+	minAspect    float64
+	maxAspect    float64
+}
+
+var (
+	slideFilterOnce sync.Once
+	slideBounds     slideFilter
+)
+
+// loadSlideFilter reads SLIDE_MIN_DIMENSION (default 200px) and
+// SLIDE_MIN_ASPECT / SLIDE_MAX_ASPECT (width/height, default 0.5-3.0)
+func loadSlideFilter() slideFilter {
+	slideFilterOnce.Do(func() {
+		slideBounds = slideFilter{minDimension: 200, minAspect: 0.5, maxAspect: 3.0}
+		if v, err := strconv.Atoi(os.Getenv("SLIDE_MIN_DIMENSION")); err == nil && v >= 0 {
+			slideBounds.minDimension = v
+		}
+		if v, err := strconv.ParseFloat(os.Getenv("SLIDE_MIN_ASPECT"), 64); err == nil && v > 0 {
+			slideBounds.minAspect = v
+		}
+		if v, err := strconv.ParseFloat(os.Getenv("SLIDE_MAX_ASPECT"), 64); err == nil && v > 0 {
+			slideBounds.maxAspect = v
+		}
+	})
+	return slideBounds
+}
+
+// accepts reports whether an image of the given size looks like a slide
+func (f slideFilter) accepts(width, height int) bool {
+	if width < f.minDimension || height < f.minDimension || height == 0 {
+		return false
+	}
+	aspect := float64(width) / float64(height)
+	return aspect >= f.minAspect && aspect <= f.maxAspect
+}
+
+// fetchImage downloads one slide into a temp file in cfg's image format,
+// JPEG by default. Sources already in that format are kept as-is unless cfg
+// asks for a specific quality or a smaller size; other formats are re-encoded.
+// On success the caller owns the returned file and must remove it; on any
+// error no temp file is left behind.
+func fetchImage(ctx context.Context, client *fasthttp.Client, urlStr string, cfg fetchConfig, stats *ConversionStats) (string, error) {
 	// Build fasthttp request
 	req := fasthttp.AcquireRequest()
 	defer fasthttp.ReleaseRequest(req)
 	req.SetRequestURI(urlStr)
 	req.Header.SetMethod(fasthttp.MethodGet)
+	setBrowserHeaders(req, acceptImage)
 
 	resp := fasthttp.AcquireResponse()
 	defer fasthttp.ReleaseResponse(resp)
 
-	// Perform request with timeout (since fasthttp doesn't support context natively)
-	if err := client.DoTimeout(req, resp, 20*time.Second); err != nil {
+	err := doImageRequest(ctx, client, req, resp, urlStr, cfg.timeout())
+	if errors.Is(err, fasthttp.ErrBodyTooLarge) {
+		return "", fmt.Errorf("image %s is larger than MAX_IMAGE_BYTES (%d bytes)", urlStr, client.MaxResponseBodySize)
+	}
+	if err != nil {
 		return "", fmt.Errorf("error fetching image: %w", err)
 	}
 
+	if resp.StatusCode() == fasthttp.StatusTooManyRequests {
+		return "", rateLimitedError(resp)
+	}
+
 	if resp.StatusCode() != fasthttp.StatusOK {
 		return "", fmt.Errorf("failed to fetch image: %s (status %d)", urlStr, resp.StatusCode())
 	}
 
-	// Decode image
+	// Read the format and size from the header, a full decode may not be needed
 	imgData := resp.Body()
-	img, _, err := image.Decode(bytes.NewReader(imgData))
+	stats.addImage(len(imgData))
+	imgCfg, format, err := image.DecodeConfig(bytes.NewReader(imgData))
 	if err != nil {
-		fmt.Println(err)
+		return "", fmt.Errorf("failed to decode image %s: %w", urlStr, err)
+	}
+
+	// Drop icons, logos and other junk that matched the slide selector
+	if !loadSlideFilter().accepts(imgCfg.Width, imgCfg.Height) {
+		stats.markFiltered(urlStr)
+		return "", errSlideFiltered
+	}
+	width, height := imgCfg.Width, imgCfg.Height
+	resize := cfg.MaxDimension > 0 && (width > cfg.MaxDimension || height > cfg.MaxDimension)
+	if resize {
+		// Longest side becomes MaxDimension, aspect ratio preserved
+		if width >= height {
+			width, height = cfg.MaxDimension, int(math.Round(float64(height)*float64(cfg.MaxDimension)/float64(width)))
+		} else {
+			width, height = int(math.Round(float64(width)*float64(cfg.MaxDimension)/float64(height))), cfg.MaxDimension
+		}
+	}
+	stats.recordDimensions(urlStr, width, height)
+
+	// Encode into a pooled buffer, then write it out in one call. The
+	// response body itself is already pooled by fasthttp.
+	buf := getEncodeBuffer()
+	defer putEncodeBuffer(buf)
+
+	encoded := imgData
+	watermark := cfg.hasWatermark()
+	requality := cfg.JPEGQuality > 0 && !cfg.lossless()
+	if format != cfg.imageFormat() || requality || resize || watermark {
+		img, _, err := image.Decode(bytes.NewReader(imgData))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image %s: %w", urlStr, err)
+		}
+
+		// Animated/transparent GIFs get a clean static first frame, keeping
+		// transparency when the output format has an alpha channel
+		if format == "gif" {
+			var background color.Color = color.White
+			if cfg.keepsAlpha() {
+				background = color.Transparent
+			}
+			img, err = flattenGIF(imgData, background)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		if resize {
+			img = imaging.Resize(img, width, height, imaging.Lanczos)
+		}
+		if watermark {
+			img = applyWatermark(ctx, img, cfg.Watermark)
+		}
+
+		if err := cfg.encodeImage(buf, img); err != nil {
+			return "", err
+		}
+		encoded = buf.Bytes()
+	}
+
+	// Decoding can take a while, don't write a file nobody is waiting for
+	if err := ctx.Err(); err != nil {
 		return "", err
 	}
 
-	// Create temp file
-	tmpFile, err := os.CreateTemp("", "slide-*.jpg")
+	// Create temp file only once there is something to write
+	tmpFile, err := os.CreateTemp(tempDir, "slide-*"+imageFormatExtensions[cfg.imageFormat()])
 	if err != nil {
 		return "", err
 	}
-	defer tmpFile.Close()
-
-	// Convert to RGB and encode as JPEG
-	rgbImg := imaging.Clone(img)
-	if err := jpeg.Encode(tmpFile, rgbImg, &jpeg.Options{Quality: 90}); err != nil {
+	_, err = tmpFile.Write(encoded)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
 		return "", err
 	}
 
 	return tmpFile.Name(), nil
 }
 
-func fetchImagesConcurrently(urls []string, maxConcurrency int64) ([]string, error) {
-	ctx := context.Background()
+// maxPooledBufferSize keeps unusually large encodes from pinning memory in the pool
+const maxPooledBufferSize = 16 << 20
+
+var encodeBufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getEncodeBuffer returns an empty buffer from the pool
+func getEncodeBuffer() *bytes.Buffer {
+	buf := encodeBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putEncodeBuffer returns buf to the pool; it must not be used afterwards
+func putEncodeBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	encodeBufferPool.Put(buf)
+}
+
+// flattenGIF decodes the first GIF frame and draws it onto a background
+// canvas of the full logical screen size, avoiding transparency artifacts.
+func flattenGIF(data []byte, background color.Color) (image.Image, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("gif has no frames")
+	}
+
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		bounds = g.Image[0].Bounds()
+	}
+
+	canvas := image.NewNRGBA(bounds)
+	draw.Draw(canvas, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(canvas, g.Image[0].Bounds(), g.Image[0], g.Image[0].Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
+// defaultHeadFailThreshold is the failing fraction tolerated by the HEAD pre-check
+const defaultHeadFailThreshold = 0.1
+
+// headFailThreshold reads HEAD_FAIL_THRESHOLD (0-1) for precheckImageURLs
+func headFailThreshold() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("HEAD_FAIL_THRESHOLD"), 64); err == nil && v >= 0 && v <= 1 {
+		return v
+	}
+	return defaultHeadFailThreshold
+}
+
+// headImage checks that urlStr answers a HEAD with 200 and an image content
+// type. Hosts that refuse HEAD (405) are treated as passing.
+func headImage(ctx context.Context, client *fasthttp.Client, urlStr string) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(urlStr)
+	req.Header.SetMethod(fasthttp.MethodHead)
+	setBrowserHeaders(req, acceptImage)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+	resp.SkipBody = true
+
+	if err := doHostLimited(ctx, client, req, resp, 10*time.Second); err != nil {
+		return err
+	}
+
+	if resp.StatusCode() == fasthttp.StatusMethodNotAllowed {
+		return nil
+	}
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode())
+	}
+	if contentType := string(resp.Header.ContentType()); !strings.HasPrefix(contentType, "image/") {
+		return fmt.Errorf("unexpected content type %q", contentType)
+	}
+	return nil
+}
+
+// precheckImageURLs HEADs every url before the bulk download and aborts when
+// more than HEAD_FAIL_THRESHOLD of them look broken
+func precheckImageURLs(ctx context.Context, client *fasthttp.Client, urls []string, maxConcurrency int64) error {
 	sem := semaphore.NewWeighted(maxConcurrency)
 	var wg sync.WaitGroup
-
-	client := &fasthttp.Client{}
-	results := make([]string, len(urls))
-	errors := make([]error, len(urls))
+	errs := make([]error, len(urls))
 
 	for i, urlStr := range urls {
 		wg.Add(1)
 		go func(i int, urlStr string) {
 			defer wg.Done()
 			if err := sem.Acquire(ctx, 1); err != nil {
-				errors[i] = err
+				errs[i] = err
+				return
+			}
+			defer sem.Release(1)
+			errs[i] = headImage(ctx, client, urlStr)
+		}(i, urlStr)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	failed, example := 0, ""
+	for i, err := range errs {
+		if err != nil {
+			if failed == 0 {
+				example = fmt.Sprintf("slide %d: %v", i+1, err)
+			}
+			failed++
+		}
+	}
+
+	if len(urls) > 0 && float64(failed)/float64(len(urls)) > headFailThreshold() {
+		return &CustomAPIError{
+			StatusCode: 502,
+			Code:       CodeFetchFailed,
+			Detail:     fmt.Sprintf("%d of %d slide images failed the pre-check (%s)", failed, len(urls), example),
+		}
+	}
+	return nil
+}
+
+// fetchImagesConcurrently downloads all urls, keeping results in input order.
+// By default every download runs to completion before the first error is
+// reported (collect-all); with opts.FailFast the first failure cancels the
+// downloads that have not started yet. Cancelling ctx does the same.
+func fetchImagesConcurrently(ctx context.Context, urls []string, maxConcurrency int64, opts ConversionOptions, stats *ConversionStats) ([]string, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sem := semaphore.NewWeighted(maxConcurrency)
+	var wg sync.WaitGroup
+
+	// Decks repeating an image (section dividers etc.) download it once
+	unique, slidesOf := dedupeURLs(urls)
+	if dupes := len(urls) - len(unique); dupes > 0 {
+		loggerFrom(ctx).Debug("skipping duplicate slide images", "duplicates", dupes)
+	}
+
+	client := opts.httpClient()
+	if opts.HeadCheck {
+		if err := precheckImageURLs(ctx, client, unique, maxConcurrency); err != nil {
+			return nil, err
+		}
+	}
+
+	files := make([]string, len(unique))
+	errs := make([]error, len(unique))
+
+	var fetched atomic.Int64
+	opts.reportProgress(PhaseFetching, 0, len(urls))
+
+	for u, urlStr := range unique {
+		wg.Add(1)
+		go func(u int, urlStr string) {
+			defer wg.Done()
+			if err := sem.Acquire(ctx, 1); err != nil {
+				errs[u] = err
 				return
 			}
 			defer sem.Release(1)
 
-			filePath, err := fetchImage(ctx, client, urlStr)
+			imageCtx, span := tracer.Start(ctx, "download_image", trace.WithAttributes(
+				attribute.String("url", urlStr),
+				attribute.Int("slide", slidesOf[u][0]+1),
+			))
+			filePath, err := fetchImage(imageCtx, client, urlStr, opts.fetchConfig(), stats)
+			if errors.Is(err, errSlideFiltered) {
+				span.SetAttributes(attribute.Bool("filtered", true))
+				endSpan(span, nil)
+			} else {
+				endSpan(span, err)
+			}
+			if err == nil || errors.Is(err, errSlideFiltered) {
+				opts.reportProgress(PhaseFetching, int(fetched.Add(int64(len(slidesOf[u])))), len(urls))
+			}
+			if errors.Is(err, errSlideFiltered) {
+				return
+			}
 			if err != nil {
-				errors[i] = err
+				if !errors.Is(err, context.Canceled) {
+					loggerFrom(ctx).Warn("slide download failed", "slide", slidesOf[u][0]+1, "url", urlStr, "error", err)
+				}
+				errs[u] = err
+				if opts.FailFast {
+					cancel()
+				}
 				return
 			}
-			results[i] = filePath
-		}(i, urlStr)
+			files[u] = filePath
+		}(u, urlStr)
 	}
 
 	wg.Wait()
 
-	for _, err := range errors {
-		if err != nil {
-			for _, file := range results {
-				if file != "" {
-					_ = os.Remove(file)
-				}
+	// Every slide keeps its own file, so repeats get a copy of the download
+	results := make([]string, len(urls))
+	for u, file := range files {
+		if file == "" {
+			continue
+		}
+		results[slidesOf[u][0]] = file
+		for _, slide := range slidesOf[u][1:] {
+			if errs[u] != nil {
+				break
+			}
+			results[slide], errs[u] = copyTempFile(file)
+		}
+	}
+
+	// Report the root cause rather than a cancellation it triggered
+	var firstErr error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			firstErr = err
+			break
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr != nil {
+		for _, file := range results {
+			if file != "" {
+				_ = os.Remove(file)
 			}
-			return nil, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("Failed to fetch images: %v", err)}
 		}
+
+		// A cancelled or expired request is not a fetch failure
+		if err := parent.Err(); err != nil {
+			return nil, err
+		}
+
+		// Keep upstream rate limiting visible to the client
+		var apiErr *CustomAPIError
+		if errors.As(firstErr, &apiErr) && apiErr.RetryAfter > 0 {
+			return nil, apiErr
+		}
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeFetchFailed, Detail: fmt.Sprintf("Failed to fetch images: %v", firstErr)}
+	}
+
+	// Compact away filtered slides, preserving order
+	kept := results[:0]
+	for _, file := range results {
+		if file != "" {
+			kept = append(kept, file)
+		}
+	}
+	if len(kept) == 0 && len(urls) > 0 {
+		return nil, &CustomAPIError{StatusCode: 422, Code: CodeSlidesFiltered, Detail: "All slide images were filtered out as non-slides"}
+	}
+	opts.reportProgress(PhaseConverting, len(urls), len(urls))
+
+	return kept, nil
+}
+
+// dedupeURLs returns urls without repeats, in first-seen order, along with the
+// slide indexes each unique URL appears at
+func dedupeURLs(urls []string) ([]string, [][]int) {
+	var unique []string
+	var slidesOf [][]int
+	seen := make(map[string]int, len(urls))
+	for i, urlStr := range urls {
+		if u, ok := seen[urlStr]; ok {
+			slidesOf[u] = append(slidesOf[u], i)
+			continue
+		}
+		seen[urlStr] = len(unique)
+		unique = append(unique, urlStr)
+		slidesOf = append(slidesOf, []int{i})
+	}
+	return unique, slidesOf
+}
+
+// copyTempFile copies a downloaded slide to a new temp file with the same extension
+func copyTempFile(src string) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(tempDir, "slide-*"+filepath.Ext(src))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// parseHexColor parses "#RRGGBB" or "RRGGBB" into an opaque color
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
 	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// PDF page modes accepted by the page_mode param
+const (
+	PageModeFitA4      = "fit-a4"
+	PageModeMatchImage = "match-image"
+)
+
+// pdfPixelMM converts image pixels to millimetres at 96 DPI for match-image pages
+const pdfPixelMM = 25.4 / 96
 
-	return results, nil
+// pdfCreator identifies this service in the Creator field of generated PDFs
+const pdfCreator = "golang-ssdl"
+
+// pdfInfo is the document metadata written into generated PDFs
+type pdfInfo struct {
+	Title   string
+	Author  string
+	Subject string
 }
 
-// convertImagePathsToPDF creates a PDF from image files
-func convertImagePathsToPDF(imagePaths []string, pdfPath string) error {
+// convertImagePathsToPDF creates a PDF from image files. In fit-a4 mode each
+// slide is scaled onto an A4 page turned landscape for wide images; in
+// match-image mode every page takes the image's own size, leaving no margins.
+// A non-nil background fills the letterbox area around each slide; nil
+// leaves pages white.
+func convertImagePathsToPDF(imagePaths []string, pdfPath string, pageMode string, background *color.RGBA, info pdfInfo) error {
 	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle(info.Title, true)
+	pdf.SetAuthor(info.Author, true)
+	pdf.SetSubject(info.Subject, true)
+	pdf.SetCreator(pdfCreator, true)
+	if background != nil {
+		pdf.SetFillColor(int(background.R), int(background.G), int(background.B))
+	}
+	a4Width, a4Height := pdf.GetPageSize()
 
 	for _, imgPath := range imagePaths {
 		// Get image dimensions
-		file, err := os.Open(imgPath)
+		img, err := decodeImageConfig(imgPath)
 		if err != nil {
 			return err
 		}
-		defer file.Close()
+		width, height := float64(img.Width), float64(img.Height)
 
-		img, _, err := image.DecodeConfig(file)
-		if err != nil {
-			return err
+		var pageWidth, pageHeight float64
+		switch {
+		case pageMode == PageModeMatchImage:
+			pageWidth, pageHeight = width*pdfPixelMM, height*pdfPixelMM
+		case width > height:
+			pageWidth, pageHeight = a4Height, a4Width
+		default:
+			pageWidth, pageHeight = a4Width, a4Height
 		}
 
-		// Calculate dimensions to fit A4
-		width, height := float64(img.Width), float64(img.Height)
-		pageWidth, pageHeight := pdf.GetPageSize()
+		// Scale the image to fit the page and centre it, so the spare
+		// space on A4 pages is split evenly between both sides
 		ratio := math.Min(pageWidth/width, pageHeight/height)
 		width *= ratio
 		height *= ratio
+		x, y := (pageWidth-width)/2, (pageHeight-height)/2
 
-		pdf.AddPage()
-		pdf.Image(imgPath, 0, 0, width, height, false, "", 0, "")
+		pdf.AddPageFormat("P", gofpdf.SizeType{Wd: pageWidth, Ht: pageHeight})
+		if background != nil {
+			pdf.Rect(0, 0, pageWidth, pageHeight, "F")
+		}
+		pdf.Image(imgPath, x, y, width, height, false, "", 0, "")
 	}
 
 	return pdf.OutputFileAndClose(pdfPath)
 }
 
-// uploadToFTP uploads a file to an FTP server
-func uploadToFTP(filePath, remotePath string) error {
-	ftpHost := os.Getenv("FTP_HOST")
-	ftpUser := os.Getenv("FTP_USER")
-	ftpPass := os.Getenv("FTP_PASS")
-	ftpPortStr := os.Getenv("FTP_PORT")
-	if ftpPortStr == "" {
-		ftpPortStr = "21"
+// DefaultPathTemplate keeps the original SS_DL/<ddmmyyyy>/<filename> layout
+const DefaultPathTemplate = "SS_DL/{date}/{filename}"
+
+// pathTemplateToken matches a {token} in PATH_TEMPLATE
+var pathTemplateToken = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// pathTemplateTokens lists the tokens PATH_TEMPLATE may use
+var pathTemplateTokens = map[string]bool{
+	"date":     true,
+	"year":     true,
+	"month":    true,
+	"day":      true,
+	"type":     true,
+	"docshort": true,
+	"filename": true,
+}
+
+// validatePathTemplate rejects unknown tokens, stray braces, absolute paths
+// and templates that would put every output at the same path
+func validatePathTemplate(tmpl string) error {
+	for _, match := range pathTemplateToken.FindAllStringSubmatch(tmpl, -1) {
+		if !pathTemplateTokens[match[1]] {
+			return fmt.Errorf("unknown token {%s}", match[1])
+		}
 	}
-	ftpPort, err := strconv.Atoi(ftpPortStr)
-	if err != nil {
-		return err
+	if rest := pathTemplateToken.ReplaceAllString(tmpl, ""); strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("unbalanced braces")
 	}
-
-	// Connect to FTP
-	fmt.Println("Connecting...")
-	conn, err := ftp.Dial(fmt.Sprintf("%s:%d", ftpHost, ftpPort), ftp.DialWithTimeout(10*time.Second))
-	if err != nil {
-		return err
+	if !strings.Contains(tmpl, "{filename}") {
+		return fmt.Errorf("{filename} is required")
+	}
+	if strings.HasPrefix(tmpl, "/") {
+		return fmt.Errorf("must be a relative path")
+	}
+	for _, segment := range strings.Split(tmpl, "/") {
+		if segment == ".." {
+			return fmt.Errorf("must not contain '..'")
+		}
 	}
-	defer conn.Quit()
+	return nil
+}
 
-	// Login
-	err = conn.Login(ftpUser, ftpPass)
-	if err != nil {
-		return err
+// renderPathTemplate fills in tmpl's tokens for one output file
+func renderPathTemplate(tmpl, filename string, opts ConversionOptions, now time.Time) string {
+	values := map[string]string{
+		"date":     now.Format("02012006"),
+		"year":     now.Format("2006"),
+		"month":    now.Format("01"),
+		"day":      now.Format("02"),
+		"type":     strings.ToLower(opts.OutputType),
+		"docshort": opts.DocShort,
+		"filename": filename,
 	}
+	rendered := pathTemplateToken.ReplaceAllStringFunc(tmpl, func(token string) string {
+		return values[token[1:len(token)-1]]
+	})
 
-	// Create directories if needed
-	dirs := strings.Split(remotePath, "/")
-	remoteDir := strings.Join(dirs[:len(dirs)-1], "/")
-	remoteFile := dirs[len(dirs)-1]
+	// Empty tokens must not leave "//" or a leading slash behind
+	var segments []string
+	for _, segment := range strings.Split(rendered, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
 
-	err = conn.ChangeDir("/")
-	if err != nil {
-		return err
+// buildRemotePath returns the remote path for an output file: the
+// per-request opts.RemoteDir when set, otherwise PATH_TEMPLATE, with
+// opts.Variant as the file's parent directory
+func buildRemotePath(filename string, opts ConversionOptions) string {
+	if opts.Variant != "" {
+		filename = opts.Variant + "/" + filename
+	}
+	if opts.RemoteDir != "" {
+		return fmt.Sprintf("%s/%s", opts.RemoteDir, filename)
 	}
+	return renderPathTemplate(pathTemplate, filename, opts, time.Now())
+}
 
-	for _, dir := range strings.Split(remoteDir, "/") {
-		if dir == "" {
-			continue
-		}
-		err = conn.ChangeDir(dir)
-		if err != nil {
-			err = conn.MakeDir(dir)
-			if err != nil {
-				return err
-			}
-			err = conn.ChangeDir(dir)
-			if err != nil {
-				return err
-			}
-		}
+// sanitizeRemoteDir validates a client-supplied remote directory. Only
+// relative paths made of [A-Za-z0-9._-] segments are accepted; absolute
+// paths and ".." traversal are rejected.
+func sanitizeRemoteDir(dir string) (string, error) {
+	dir = strings.TrimSpace(dir)
+	if strings.HasPrefix(dir, "/") || strings.HasPrefix(dir, "\\") || strings.Contains(dir, ":") {
+		return "", fmt.Errorf("remote_dir must be a relative path")
 	}
 
-	// Upload file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return err
+	var segments []string
+	for _, segment := range strings.Split(strings.ReplaceAll(dir, "\\", "/"), "/") {
+		switch {
+		case segment == "" || segment == ".":
+			continue
+		case segment == "..":
+			return "", fmt.Errorf("remote_dir must not contain '..'")
+		case !remoteDirSegment.MatchString(segment):
+			return "", fmt.Errorf("remote_dir segment %q contains invalid characters", segment)
+		}
+		segments = append(segments, segment)
 	}
-	defer file.Close()
 
-	err = conn.Stor(remoteFile, file)
-	if err != nil {
-		return err
+	if len(segments) == 0 {
+		return "", fmt.Errorf("remote_dir can't be empty")
 	}
+	return strings.Join(segments, "/"), nil
+}
 
+var remoteDirSegment = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// downscaleImageFiles rewrites each JPEG wider than maxWidth in place, scaled
+// down to maxWidth. Images already within maxWidth are left untouched.
+//
+// This backs the PDF preview_resolution option. gofpdf embeds each image once,
+// so there is no true dual-resolution (preview + print) embedding: a smaller
+// preview_resolution makes the PDF smaller and faster to open, but prints
+// softer. Roughly, file size scales with pixel count, so halving the width
+// cuts the embedded image data to about a quarter. Leave it unset to embed
+// the downloaded resolution unchanged for archival quality.
+func downscaleImageFiles(imagePaths []string, maxWidth, quality int) error {
+	for _, imgPath := range imagePaths {
+		img, err := imaging.Open(imgPath)
+		if err != nil {
+			return err
+		}
+		if img.Bounds().Dx() <= maxWidth {
+			continue
+		}
+		img = imaging.Resize(img, maxWidth, 0, imaging.Lanczos)
+		if err := imaging.Save(img, imgPath, imaging.JPEGQuality(quality)); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// ConvertURLsToPDF converts image URLs to PDF and uploads to FTP
-func ConvertURLsToPDF(imageURLs []string, pdfFilename string) (string, int64, error) {
+// ConvertURLsToPDF converts image URLs to PDF and uploads it to storage
+func ConvertURLsToPDF(ctx context.Context, store Storage, imageURLs []string, pdfFilename string, info pdfInfo, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
 	// Download images
-	imagePaths, err := fetchImagesConcurrently(imageURLs, 25000)
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
 	if err != nil {
 		return "", 0, err
 	}
@@ -310,11 +1248,18 @@ func ConvertURLsToPDF(imageURLs []string, pdfFilename string) (string, int64, er
 	}()
 
 	if len(imagePaths) == 0 {
-		return "", 0, &CustomAPIError{StatusCode: 500, Detail: "No images to convert to PDF"}
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "No images to convert to PDF"}
+	}
+
+	// Shrink embedded images, fit-a4 pages keep their size regardless
+	if opts.PreviewResolution > 0 {
+		if err := downscaleImageFiles(imagePaths, opts.PreviewResolution, opts.fetchConfig().encodeQuality()); err != nil {
+			return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to resize images: %v", err)}
+		}
 	}
 
 	// Create temp PDF file
-	tmpPDF, err := os.CreateTemp("", "slides-*.pdf")
+	tmpPDF, err := os.CreateTemp(tempDir, "slides-*.pdf")
 	if err != nil {
 		return "", 0, err
 	}
@@ -322,35 +1267,24 @@ func ConvertURLsToPDF(imageURLs []string, pdfFilename string) (string, int64, er
 	defer os.Remove(tmpPDF.Name())
 
 	// Convert to PDF
-	err = convertImagePathsToPDF(imagePaths, tmpPDF.Name())
+	err = convertImagePathsToPDF(imagePaths, tmpPDF.Name(), opts.PageMode, opts.PageBackground, info)
 	if err != nil {
-		return "", 0, &CustomAPIError{StatusCode: 500, Detail: err.Error()}
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: err.Error()}
 	}
 
-	// Prepare FTP path
-	dateStr := time.Now().Format("02012006")
-	ftpDir := fmt.Sprintf("SS_DL/%s", dateStr)
-	ftpPath := fmt.Sprintf("%s/%s", ftpDir, pdfFilename)
-
-	// Upload to FTP
-	err = uploadToFTP(tmpPDF.Name(), ftpPath)
-	if err != nil {
-		return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("FTP upload failed: %v", err)}
-	}
-
-	// Get file size
-	fileInfo, err := os.Stat(tmpPDF.Name())
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpPDF.Name(), buildRemotePath(pdfFilename, opts))
 	if err != nil {
-		return "", 0, err
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
 	}
 
-	return ftpPath, fileInfo.Size(), nil
+	return downloadURL, size, nil
 }
 
-// ConvertURLsToPPTX converts image URLs to PPTX and uploads to FTP
-func ConvertURLsToPPTX(imageURLs []string, pptxFilename string) (string, int64, error) {
+// ConvertURLsToPPTX converts image URLs to PPTX and uploads it to storage
+func ConvertURLsToPPTX(ctx context.Context, store Storage, imageURLs []string, pptxFilename string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
 	// Download images
-	imagePaths, err := fetchImagesConcurrently(imageURLs, 10)
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
 	if err != nil {
 		return "", 0, err
 	}
@@ -367,12 +1301,12 @@ func ConvertURLsToPPTX(imageURLs []string, pptxFilename string) (string, int64,
 	for _, imgPath := range imagePaths {
 		err := p.AddImageSlide(imgPath)
 		if err != nil {
-			return "", 0, fmt.Errorf("failed to add image to slide: %v", err)
+			return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to add image to slide: %v", err)}
 		}
 	}
 
 	// Create temp PPTX file
-	tmpPPTX, err := os.CreateTemp("", "slides-*.pptx")
+	tmpPPTX, err := os.CreateTemp(tempDir, "slides-*.pptx")
 	if err != nil {
 		return "", 0, err
 	}
@@ -382,65 +1316,58 @@ func ConvertURLsToPPTX(imageURLs []string, pptxFilename string) (string, int64,
 	// Save presentation
 	err = p.Save(tmpPPTX.Name())
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to save PPTX: %v", err)
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to save PPTX: %v", err)}
 	}
 
-	// Prepare FTP path
-	dateStr := time.Now().Format("02012006")
-	ftpDir := fmt.Sprintf("SS_DL/%s", dateStr)
-	ftpPath := fmt.Sprintf("%s/%s", ftpDir, pptxFilename)
-
-	// Upload to FTP
-	err = uploadToFTP(tmpPPTX.Name(), ftpPath)
-	if err != nil {
-		return "", 0, fmt.Errorf("FTP upload failed: %v", err)
+	// A deck GoPPT laid out unexpectedly is still usable at its default size
+	slideSize := resolveSlideSize(opts.SlideSize, imagePaths)
+	if err := resizePPTX(tmpPPTX.Name(), slideSize, imagePaths); err != nil {
+		loggerFrom(ctx).Warn("keeping the default PPTX slide size", "slide_size", slideSize, "error", err)
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(tmpPPTX.Name())
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpPPTX.Name(), buildRemotePath(pptxFilename, opts))
 	if err != nil {
-		return "", 0, err
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
 	}
 
-	return ftpPath, fileInfo.Size(), nil
+	return downloadURL, size, nil
 }
 
-// ConvertURLsToZip converts image URLs to ZIP and uploads to FTP
-func ConvertURLsToZip(imageURLs []string, zipFilename string) (string, int64, error) {
-	// Download images
-	imagePaths, err := fetchImagesConcurrently(imageURLs, 10)
-	if err != nil {
-		return "", 0, err
-	}
-	defer func() {
-		for _, path := range imagePaths {
-			os.Remove(path)
-		}
-	}()
+// defaultZipFinalizeRetries applies when ZIP_FINALIZE_RETRIES is unset
+const defaultZipFinalizeRetries = 2
 
-	// Create temp ZIP file
-	tmpZip, err := os.CreateTemp("", "slides-*.zip")
-	if err != nil {
-		return "", 0, err
+// errZipFinalize marks failures writing the archive trailer or flushing the file
+var errZipFinalize = errors.New("failed to finalize zip")
+
+// zipFinalizeRetries reads how many rebuilds to attempt from ZIP_FINALIZE_RETRIES
+func zipFinalizeRetries() int {
+	if v, err := strconv.Atoi(os.Getenv("ZIP_FINALIZE_RETRIES")); err == nil && v >= 0 {
+		return v
 	}
-	defer os.Remove(tmpZip.Name())
+	return defaultZipFinalizeRetries
+}
 
-	// Create ZIP archive
-	zipWriter := zip.NewWriter(tmpZip)
+// writeImagesZip writes the images to out as entries of an archive named by
+// naming, followed by manifest when it isn't nil
+func writeImagesZip(out io.Writer, imagePaths []string, naming zipNaming, manifest *zipManifest) error {
+	zipWriter := zip.NewWriter(out)
+	entryNames := make([]string, len(imagePaths))
 	for i, imgPath := range imagePaths {
 		file, err := os.Open(imgPath)
 		if err != nil {
 			zipWriter.Close()
-			return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("Failed to open image: %v", err)}
+			return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to open image: %v", err)}
 		}
 
-		// Create zip entry
-		entryName := fmt.Sprintf("image_%d.jpg", i+1)
+		// Create zip entry, named after the format the image was saved in
+		entryName := naming.name(i, imgPath)
+		entryNames[i] = entryName
 		zipEntry, err := zipWriter.Create(entryName)
 		if err != nil {
 			file.Close()
 			zipWriter.Close()
-			return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("Failed to create zip entry: %v", err)}
+			return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to create zip entry: %v", err)}
 		}
 
 		// Copy file to zip
@@ -448,127 +1375,836 @@ func ConvertURLsToZip(imageURLs []string, zipFilename string) (string, int64, er
 		file.Close()
 		if err != nil {
 			zipWriter.Close()
-			return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
+			return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write to zip: %v", err)}
 		}
 	}
 
-	err = zipWriter.Close()
+	if err := writeZipManifest(zipWriter, manifest, entryNames); err != nil {
+		zipWriter.Close()
+		return err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("%w: %v", errZipFinalize, err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes passed through to w and remembers the
+// first error w returned
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+// uploadZipFile writes the archive to a temp file and uploads it, for
+// backends that need the full size up front
+func uploadZipFile(ctx context.Context, store Storage, remotePath string, writeZip func(io.Writer) error) (string, int64, error) {
+	tmpZip, err := os.CreateTemp(tempDir, "slides-*.zip")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmpZip.Name())
+	defer tmpZip.Close()
+
+	if err := writeZip(tmpZip); err != nil {
+		return "", 0, err
+	}
+	if err := tmpZip.Sync(); err != nil {
+		return "", 0, fmt.Errorf("%w: %v", errZipFinalize, err)
+	}
+
+	downloadURL, size, err := store.Upload(ctx, tmpZip.Name(), remotePath)
 	if err != nil {
-		return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("Failed to close zip: %v", err)}
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
 	}
+	return downloadURL, size, nil
+}
 
-	// Prepare FTP path
-	dateStr := time.Now().Format("02012006")
-	ftpDir := fmt.Sprintf("SS_DL/%s", dateStr)
-	ftpPath := fmt.Sprintf("%s/%s", ftpDir, zipFilename)
+// streamZip produces the archive into a pipe while the backend uploads from
+// the other end, so no copy of it ever touches the disk. The reported size is
+// the byte count written through the pipe.
+func streamZip(ctx context.Context, store streamUploader, remotePath string, writeZip func(io.Writer) error) (string, int64, error) {
+	pr, pw := io.Pipe()
+	counter := &countingWriter{w: pw}
+	writeErr := make(chan error, 1)
+	go func() {
+		err := writeZip(counter)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+
+	downloadURL, uploadErr := store.UploadStream(ctx, pr, remotePath)
+	// Unblock the writer if the upload stopped reading early
+	pr.Close()
+	// A writer that failed on the pipe was cut off by the upload, anything
+	// else is an archive error the upload only saw secondhand
+	if err := <-writeErr; err != nil && (counter.err == nil || uploadErr == nil) {
+		return "", 0, err
+	}
+	if uploadErr != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", uploadErr)}
+	}
+	return downloadURL, counter.n, nil
+}
 
-	// Upload to FTP
-	err = uploadToFTP(tmpZip.Name(), ftpPath)
+// ConvertURLsToZip converts image URLs to ZIP and uploads it to storage. The
+// title feeds the {title} token of NamePattern and, with the srcset slides,
+// the manifest written with IncludeManifest.
+func ConvertURLsToZip(ctx context.Context, store Storage, imageURLs []string, zipFilename, title string, slides []map[int]string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
+	// Download images
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
 	if err != nil {
-		return "", 0, &CustomAPIError{StatusCode: 500, Detail: fmt.Sprintf("FTP upload failed: %v", err)}
+		return "", 0, err
+	}
+	defer func() {
+		for _, path := range imagePaths {
+			os.Remove(path)
+		}
+	}()
+
+	var manifest *zipManifest
+	if opts.IncludeManifest {
+		manifest = newZipManifest(title, buildSlideIndex(slides, imageURLs, max(opts.From, 1), stats))
+	}
+
+	// Pick the archive layout, thumbnails are generated once from the downloaded images
+	naming := newZipNaming(opts.NamePattern, defaultFlatNamePattern, title, len(imagePaths))
+	writeZip := func(out io.Writer) error {
+		return writeImagesZip(out, imagePaths, naming, manifest)
+	}
+	if opts.ZipLayout == ZipLayoutGallery {
+		thumbPaths, err := generateThumbnails(imagePaths, galleryThumbWidth())
+		if err != nil {
+			return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to generate thumbnails: %v", err)}
+		}
+		defer removeFiles(thumbPaths)
+
+		naming = newZipNaming(opts.NamePattern, defaultGalleryNamePattern, title, len(imagePaths))
+		writeZip = func(out io.Writer) error {
+			return writeGalleryZip(out, imagePaths, thumbPaths, naming, manifest)
+		}
+	}
+
+	// Stream the archive straight into storage when the backend supports it
+	remotePath := buildRemotePath(zipFilename, opts)
+	upload := func() (string, int64, error) {
+		return uploadZipFile(ctx, store, remotePath, writeZip)
+	}
+	if streamer, ok := store.(streamUploader); ok {
+		upload = func() (string, int64, error) {
+			return streamZip(ctx, streamer, remotePath, writeZip)
+		}
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(tmpZip.Name())
+	// Create and upload the archive, rebuilding from the downloaded images if finalizing fails
+	downloadURL, size, err := upload()
+	retries := zipFinalizeRetries()
+	for attempt := 1; errors.Is(err, errZipFinalize) && attempt <= retries; attempt++ {
+		loggerFrom(ctx).Warn("rebuilding archive", "attempt", attempt, "retries", retries, "error", err)
+		downloadURL, size, err = upload()
+	}
+	if errors.Is(err, errZipFinalize) {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to close zip: %v", err)}
+	}
 	if err != nil {
 		return "", 0, err
 	}
 
-	return ftpPath, fileInfo.Size(), nil
+	return downloadURL, size, nil
+}
+
+// ConversionOptions holds optional per-request settings for GetSlidesDownloadLink
+type ConversionOptions struct {
+	IncludeStats      bool
+	OutputType        string
+	DocShort          string
+	Width             int
+	MinWidth          int
+	NotifyEmail       string
+	SlideIndex        bool
+	IncludeManifest   bool
+	NamePattern       string
+	FailFast          bool
+	PageMode          string
+	PageBackground    *color.RGBA
+	RemoteDir         string
+	ZipLayout         string
+	HeadCheck         bool
+	PreviewResolution int
+	SheetColumns      int
+	SheetCellWidth    int
+	TIFFCompression   string
+	MaxConcurrency    int64
+	JPEGQuality       int
+	MaxDimension      int
+	Watermark         string
+	// NoWatermark skips WATERMARK_IMAGE too, for watermark=none
+	NoWatermark bool
+	// ImageFormat encodes IMAGES_ZIP slides as jpeg, png or webp, empty means jpeg
+	ImageFormat string
+	// SlideSize is the PPTX slide size, 4:3, 16:9 or auto (the default) to match the first slide
+	SlideSize string
+	// ImageTimeout bounds each slide download attempt, zero means DefaultImageTimeout
+	ImageTimeout time.Duration
+	// MaxSlides rejects decks with more slides than this, zero means no limit
+	MaxSlides int
+	// MaxQuality caps the quality of the requesting API key, see capQuality
+	MaxQuality QualityType
+	// From and To select a 1-based inclusive slide range, zero means the deck's first or last slide
+	From int
+	To   int
+	// DryRun resolves the deck and reports what would be converted without downloading anything
+	DryRun bool
+	// Client makes every SlideShare and CDN request, see httpClient
+	Client *fasthttp.Client
+	// Storage replaces the configured backend, such as a responseCapture for delivery=stream
+	Storage Storage
+	// StorageBackend picks one of the enabled backends by name, empty means STORAGE_BACKEND
+	StorageBackend string
+	// Variant names the output options, see outputVariant. buildRemotePath
+	// puts it in front of the file name so differently configured conversions
+	// of a deck never overwrite each other's files.
+	Variant string
+	// Progress is told about each downloaded slide and phase change, see progressFunc
+	Progress progressFunc
+}
+
+// DefaultJPEGQuality is used to re-encode non-JPEG slides when JPEG_QUALITY is unset
+const DefaultJPEGQuality = 90
+
+// fetchConfig controls how fetchImage re-encodes downloaded slides
+type fetchConfig struct {
+	// JPEGQuality re-encodes every slide at this quality. Zero keeps slides
+	// SlideShare already serves as JPEG byte-for-byte and encodes the rest
+	// at DefaultJPEGQuality.
+	JPEGQuality int
+	// MaxDimension downscales slides whose longest side exceeds it, zero keeps them as-is
+	MaxDimension int
+	// Watermark is drawn bottom-right on every slide, alongside WATERMARK_IMAGE when set
+	Watermark string
+	// NoWatermark leaves slides unmarked even when WATERMARK_IMAGE is set
+	NoWatermark bool
+	// ImageFormat is the format slides are saved in, empty means JPEG
+	ImageFormat string
+	// Timeout bounds each download attempt, zero means DefaultImageTimeout
+	Timeout time.Duration
+}
+
+// timeout is the per-attempt download timeout
+func (c fetchConfig) timeout() time.Duration {
+	if c.Timeout > 0 {
+		return c.Timeout
+	}
+	return DefaultImageTimeout
+}
+
+// encodeQuality is the quality used when a slide has to be re-encoded
+func (c fetchConfig) encodeQuality() int {
+	if c.JPEGQuality > 0 {
+		return c.JPEGQuality
+	}
+	return DefaultJPEGQuality
+}
+
+// fetchConfig returns the image settings for fetchImage
+func (o ConversionOptions) fetchConfig() fetchConfig {
+	return fetchConfig{JPEGQuality: o.JPEGQuality, MaxDimension: o.MaxDimension, Watermark: o.Watermark, NoWatermark: o.NoWatermark, ImageFormat: o.ImageFormat, Timeout: o.ImageTimeout}
+}
+
+// DefaultMaxConcurrency bounds parallel image downloads per conversion
+const DefaultMaxConcurrency = 10
+
+// httpClient returns the client for SlideShare requests, the shared
+// outboundClient unless the options carry their own
+func (o ConversionOptions) httpClient() *fasthttp.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	return outboundClient
+}
+
+// concurrency returns the download concurrency, defaulting to DefaultMaxConcurrency
+func (o ConversionOptions) concurrency() int64 {
+	if o.MaxConcurrency > 0 {
+		return o.MaxConcurrency
+	}
+	return DefaultMaxConcurrency
+}
+
+// checkMinWidth rejects decks where any slide's best resolution is below minWidth
+func checkMinWidth(slides []map[int]string, minWidth int) error {
+	if minWidth <= 0 {
+		return nil
+	}
+
+	deckMax, tooSmall := 0, 0
+	for _, slide := range slides {
+		best := 0
+		for width := range slide {
+			if width > best {
+				best = width
+			}
+		}
+		if best > deckMax {
+			deckMax = best
+		}
+		if best < minWidth {
+			tooSmall++
+		}
+	}
+
+	if tooSmall > 0 {
+		return &CustomAPIError{
+			StatusCode: 422,
+			Code:       CodeResolutionTooLow,
+			Detail: fmt.Sprintf("%d of %d slides are below min_width %dpx (max resolution found: %dpx)",
+				tooSmall, len(slides), minWidth, deckMax),
+		}
+	}
+	return nil
+}
+
+// pickResolution returns the smallest srcset width >= target, falling back to
+// the largest available when none reaches it. It returns -1 for an empty slide.
+func pickResolution(slide map[int]string, target int) int {
+	best, largest := -1, -1
+	for width := range slide {
+		if width >= target && (best == -1 || width < best) {
+			best = width
+		}
+		if width > largest {
+			largest = width
+		}
+	}
+	if best == -1 {
+		return largest
+	}
+	return best
+}
+
+// selectSlideImages picks an image URL for every slide via pickResolution,
+// in slide order, and reports whether any slide had to fall back below the
+// target width. Converters rely on this order: fetchImagesConcurrently keeps
+// it by writing results by index, so slide N is always the Nth output page.
+func selectSlideImages(slides []map[int]string, target int) ([]string, bool) {
+	var images []string
+	belowTarget := false
+	for _, slide := range slides {
+		width := pickResolution(slide, target)
+		if width < 0 {
+			continue
+		}
+		if width < target {
+			belowTarget = true
+		}
+		images = append(images, slide[width])
+	}
+	return images, belowTarget
+}
+
+// sliceSlideRange keeps slides from through to (1-based, inclusive), where
+// zero leaves that end of the deck open
+func sliceSlideRange(images []string, from, to int) ([]string, error) {
+	if from == 0 && to == 0 {
+		return images, nil
+	}
+	if from == 0 {
+		from = 1
+	}
+	if to == 0 {
+		to = len(images)
+	}
+	if from > len(images) || to > len(images) {
+		return nil, &CustomAPIError{StatusCode: 400, Code: CodeInvalidParams, Detail: fmt.Sprintf("Invalid slide range: deck has %d slides", len(images))}
+	}
+	if err := checkSlideRange(from, to); err != nil {
+		return nil, err
+	}
+	return images[from-1 : to], nil
+}
+
+// checkSlideRange rejects a from/to pair no deck could satisfy. Zero leaves
+// that end of the range open.
+func checkSlideRange(from, to int) error {
+	if from > 0 && to > 0 && from > to {
+		return &CustomAPIError{StatusCode: 400, Code: CodeInvalidParams, Detail: fmt.Sprintf("Invalid slide range: from (%d) is after to (%d)", from, to)}
+	}
+	return nil
+}
+
+// checkMaxSlides refuses decks with more than max slides, zero means no limit
+func checkMaxSlides(deckSlides, max int) error {
+	if max > 0 && deckSlides > max {
+		return &CustomAPIError{
+			StatusCode: 413,
+			Code:       CodeTooManySlides,
+			Detail:     fmt.Sprintf("Deck has %d slides, the limit is %d", deckSlides, max),
+		}
+	}
+	return nil
+}
+
+// docShortFromURL derives the deck slug used for output filenames from
+// /slideshow/<slug>/<id>, legacy /<user>/<slug> and /mobile/ paths. It
+// returns "" when the path names no usable slug, and callers fall back to
+// titleSlug once the deck title is known.
+func docShortFromURL(urlStr string) (string, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Invalid URL format"}
+	}
+
+	var pathParts []string
+	for _, part := range strings.Split(u.Path, "/") {
+		if part != "" {
+			pathParts = append(pathParts, part)
+		}
+	}
+	if len(pathParts) < 2 {
+		return "", &CustomAPIError{StatusCode: 400, Code: CodeInvalidURL, Detail: "Invalid SlideShare URL format"}
+	}
+	if strings.EqualFold(pathParts[0], "mobile") {
+		pathParts = pathParts[1:]
+	}
+
+	// Both shapes keep the slug in the second segment, after "slideshow" or the user
+	if len(pathParts) < 2 {
+		return "", nil
+	}
+	slug := pathParts[1]
+	if strings.EqualFold(pathParts[0], "slideshow") && strings.EqualFold(slug, "embed_code") {
+		return "", nil
+	}
+	if _, err := strconv.ParseUint(slug, 10, 64); err == nil {
+		return "", nil
+	}
+	return slug, nil
+}
+
+// titleSlug turns s into a lowercase, dash-separated ASCII slug of at most
+// maxSlugLength characters, or "slides" when nothing usable is left
+func titleSlug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case b.Len() > 0 && !dash:
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= maxSlugLength {
+			break
+		}
+	}
+
+	slug := strings.Trim(b.String(), "-")
+	if slug == "" {
+		return "slides"
+	}
+	return slug
+}
+
+// outputFilename names the file a conversion type produces for a deck, or
+// "" for types without an output file
+func outputFilename(conversionType SlidesConversionType, docShort string) string {
+	switch conversionType {
+	case PDF:
+		return sanitizeFilename(docShort, ".pdf")
+	case PPTX:
+		return sanitizeFilename(docShort, ".pptx")
+	case ImagesZip:
+		return sanitizeFilename(docShort, ".zip")
+	case HTML:
+		return sanitizeFilename(docShort+"_flipbook", ".zip")
+	case ContactSheet:
+		return sanitizeFilename(docShort+"_contact_sheet", ".png")
+	case DOCX:
+		return sanitizeFilename(docShort, ".docx")
+	case TIFF:
+		return sanitizeFilename(docShort, ".tiff")
+	default:
+		return ""
+	}
+}
+
+// maxFilenameLength bounds the base name sanitizeFilename returns
+const maxFilenameLength = 100
+
+// sanitizeFilename makes base safe as a single FTP and filesystem path
+// segment and appends ext. Whitespace runs become underscores; anything
+// but ASCII letters, digits, '.', '_' and '-' is dropped, which also
+// removes path separators, and leading dots are stripped so ".." can't
+// survive. An empty result becomes "slides". ext is reduced to its
+// alphanumerics with a single leading dot, or omitted when nothing is left.
+func sanitizeFilename(base, ext string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range base {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte('_')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	name := strings.TrimLeft(b.String(), ".")
+	if len(name) > maxFilenameLength {
+		name = name[:maxFilenameLength]
+	}
+	name = strings.TrimRight(name, ".")
+	if name == "" {
+		name = "slides"
+	}
+
+	ext = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, ext)
+	if ext == "" {
+		return name
+	}
+	return name + "." + strings.ToLower(ext)
+}
+
+// maxSlugLength keeps derived filenames well inside FTP and filesystem limits
+const maxSlugLength = 80
+
+// notifyByEmail sends the download link when notify_email was given and
+// records the outcome in data. Email failures never fail the conversion itself.
+func notifyByEmail(ctx context.Context, opts ConversionOptions, data map[string]interface{}) {
+	if opts.NotifyEmail == "" {
+		return
+	}
+	err := sendLinkEmail(opts.NotifyEmail, data)
+	if err != nil {
+		loggerFrom(ctx).Warn("failed to email download link", "email", opts.NotifyEmail, "error", err)
+	}
+	data["email_sent"] = err == nil
 }
 
 // GetSlidesDownloadLink is the main function that orchestrates the conversion
-func GetSlidesDownloadLink(urlStr string, conversionType SlidesConversionType, qualityType QualityType) (map[string]interface{}, error) {
+func GetSlidesDownloadLink(ctx context.Context, urlStr string, conversionType SlidesConversionType, qualityType QualityType, opts ConversionOptions) (map[string]interface{}, error) {
+	conversionsInFlight.Inc()
+	defer conversionsInFlight.Dec()
+
+	ctx, span := tracer.Start(ctx, "convert", trace.WithAttributes(
+		attribute.String("url", urlStr),
+		attribute.String("conversion_type", string(conversionType)),
+		attribute.String("quality", string(qualityType)),
+	))
+	start := time.Now()
+	qualityType, opts, qualityNote, err := capQuality(qualityType, opts)
+	var result map[string]interface{}
+	if err == nil {
+		result, err = getSlidesDownloadLink(ctx, urlStr, conversionType, qualityType, opts)
+	}
+	if data, ok := result["data"].(map[string]interface{}); ok && qualityNote != "" {
+		data["quality_note"] = qualityNote
+	}
+	observeConversion(conversionType, start, result, err)
+	endSpan(span, err)
+	return result, err
+}
+
+// getSlidesDownloadLink does the work of GetSlidesDownloadLink, which adds metrics
+func getSlidesDownloadLink(ctx context.Context, urlStr string, conversionType SlidesConversionType, qualityType QualityType, opts ConversionOptions) (map[string]interface{}, error) {
+	stats := newConversionStats()
+
 	// Validate URL
-	err := ValidateURL(urlStr)
+	urlStr, err := NormalizeURL(urlStr)
 	if err != nil {
 		return nil, err
 	}
 
 	// Parse URL to get document short name
-	u, err := url.Parse(urlStr)
+	docShort, err := docShortFromURL(urlStr)
 	if err != nil {
-		return nil, &CustomAPIError{StatusCode: 400, Detail: "Invalid URL format"}
+		return nil, err
 	}
 
-	pathParts := strings.Split(strings.Trim(u.Path, "/"), "/")
-	if len(pathParts) < 2 {
-		return nil, &CustomAPIError{StatusCode: 400, Detail: "Invalid SlideShare URL format"}
+	logger := loggerFrom(ctx).With("url", urlStr, "conversion_type", conversionType)
+
+	if docShort != "" {
+		docShort = sanitizeFilename(docShort, "")
+	}
+
+	// Remote paths are laid out by type and deck
+	opts.OutputType = string(conversionType)
+	opts.DocShort = docShort
+
+	// Reject what no deck could satisfy before a cache hit can answer it
+	if err := checkSlideRange(opts.From, opts.To); err != nil {
+		return nil, err
+	}
+
+	// Reuse an identical recent conversion. Outputs written to a per-request
+	// store are not shared, the next request would find nothing behind the link.
+	cache := sharedConversionCache()
+	if opts.Storage != nil || opts.DryRun {
+		cache = nil
+	}
+	cacheKey := conversionCacheKey(urlStr, conversionType, qualityType, opts)
+	opts.Variant = outputVariant(cacheKey)
+	if cache != nil {
+		if cached, ok := cache.Get(cacheKey); ok && !linkExpiresSoon(cached.Data) {
+			// max_slides is not part of the key, the cached deck must still fit it
+			if err := checkMaxSlides(cached.DeckSlides, opts.MaxSlides); err != nil {
+				return nil, err
+			}
+			logger.Info("conversion served from cache")
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cached", true))
+			data := copyResultData(cached.Data)
+			data["cached"] = true
+			if opts.IncludeStats && cached.Stats != nil {
+				data["stats"] = cached.Stats
+			}
+			notifyByEmail(ctx, opts, data)
+			return map[string]interface{}{
+				"success": true,
+				"message": "Conversion served from cache.",
+				"data":    data,
+			}, nil
+		}
 	}
-	docShort := pathParts[len(pathParts)-2]
 
 	// Fetch slide images
-	slidesData, err := FetchSlideImages(urlStr)
+	logger.Info("fetching deck")
+	fetchStart := time.Now()
+	fetchCtx, fetchSpan := tracer.Start(ctx, "fetch_page")
+	slidesData, err := FetchSlideImages(fetchCtx, opts.httpClient(), urlStr)
+	endSpan(fetchSpan, err)
 	if err != nil {
+		logger.Error("deck fetch failed", "error", err)
 		return nil, err
 	}
 
 	slides, ok := slidesData["slides"].([]map[int]string)
 	if !ok {
-		return nil, &CustomAPIError{StatusCode: 500, Detail: "Invalid slides data format"}
+		return nil, &CustomAPIError{StatusCode: 500, Code: CodeParseFailed, Detail: "Invalid slides data format"}
 	}
 
 	title, _ := slidesData["title"].(string)
+	metadata, _ := slidesData["metadata"].(map[string]interface{})
 
-	// Select quality
-	quality := 2048
-	if qualityType == SD {
-		quality = 638
+	// Decks whose URL has no slug are named after their title
+	if docShort == "" {
+		docShort = titleSlug(title)
+		opts.DocShort = docShort
 	}
+	logger.Info("deck fetched", "slides", len(slides), "duration_ms", time.Since(fetchStart).Milliseconds())
 
-	// Get high resolution images
-	var highResImages []string
-	for _, slide := range slides {
-		if url, exists := slide[quality]; exists {
-			highResImages = append(highResImages, url)
-		}
+	// Refuse decks too large to convert before downloading any images
+	if err := checkMaxSlides(len(slides), opts.MaxSlides); err != nil {
+		return nil, err
+	}
+
+	// Reject decks that only offer tiny images
+	if err := checkMinWidth(slides, opts.MinWidth); err != nil {
+		return nil, err
+	}
+
+	// Select quality, where an explicit width overrides the HD/SD preset
+	targetWidth := qualityType.width()
+	if opts.Width > 0 {
+		targetWidth = opts.Width
+	}
+
+	// Get the closest resolution at or above the target for every slide
+	highResImages, belowTarget := selectSlideImages(slides, targetWidth)
+	effectiveQuality := string(qualityType)
+	if opts.Width > 0 {
+		effectiveQuality = "CUSTOM"
+	}
+	if belowTarget {
+		effectiveQuality = "LARGEST"
 	}
 
 	if len(highResImages) == 0 {
-		return nil, &CustomAPIError{
-			StatusCode: 404,
-			Detail:     fmt.Sprintf("No %dpx resolution slides found", quality),
-		}
+		return nil, &CustomAPIError{StatusCode: 404, Code: CodeNoSlidesFound, Detail: "No slide images found"}
 	}
 
 	thumbnail := highResImages[0]
 
+	highResImages, err = sliceSlideRange(highResImages, opts.From, opts.To)
+	if err != nil {
+		return nil, err
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("slide_count", len(highResImages)))
+
+	// Dry runs stop here and describe the work a real run would do
+	if opts.DryRun {
+		data := dryRunData(slides, highResImages, max(opts.From, 1), outputFilename(conversionType, docShort))
+		data["thumbnail"] = thumbnail
+		data["quality"] = qualityType
+		data["effective_quality"] = effectiveQuality
+		data["conversion_type"] = conversionType
+		data["width"] = targetWidth
+		data["title"] = title
+		return map[string]interface{}{
+			"success": true,
+			"message": "Dry run, nothing was downloaded or uploaded.",
+			"data":    data,
+		}, nil
+	}
+
+	// JSON only lists the selected image URLs, nothing is downloaded or uploaded
+	if conversionType == JSON {
+		data := map[string]interface{}{
+			"thumbnail":         thumbnail,
+			"quality":           qualityType,
+			"effective_quality": effectiveQuality,
+			"conversion_type":   conversionType,
+			"width":             targetWidth,
+			"title":             title,
+			"slide_count":       len(highResImages),
+			"slides":            highResImages,
+		}
+		for key, value := range metadata {
+			data[key] = value
+		}
+		return map[string]interface{}{
+			"success": true,
+			"message": "Slide URLs resolved successfully.",
+			"data":    data,
+		}, nil
+	}
+
+	store := opts.Storage
+	if store == nil {
+		store, err = getNamedStorage(opts.StorageBackend)
+		if err != nil {
+			return nil, &CustomAPIError{StatusCode: 500, Code: CodeStorageUnavailable, Detail: fmt.Sprintf("Storage unavailable: %v", err)}
+		}
+	}
+	// Downloads, conversion and upload all happen under the render span
+	renderCtx, renderSpan := tracer.Start(ctx, "render", trace.WithAttributes(attribute.Int("slide_count", len(highResImages))))
+	store, uploads := withUploadRecord(store)
+	store, linkExpiry := withSignedLinks(store, linkTTL)
+	store = opts.withProgress(store, len(highResImages))
+	store = withTracing(store)
+
 	// Perform conversion based on type
-	var path string
+	var downloadURL string
+	fileName := outputFilename(conversionType, docShort)
 	var size int64
 	var message string
 	switch conversionType {
 	case PDF:
-		path, size, err = ConvertURLsToPDF(highResImages, docShort+".pdf")
+		author, _ := slidesData["author"].(string)
+		description, _ := metadata["description"].(string)
+		info := pdfInfo{Title: title, Author: author, Subject: description}
+		downloadURL, size, err = ConvertURLsToPDF(renderCtx, store, highResImages, fileName, info, opts, stats)
 		message = "PDF generated successfully."
 	case PPTX:
-		path, size, err = ConvertURLsToPPTX(highResImages, docShort+".pptx")
+		downloadURL, size, err = ConvertURLsToPPTX(renderCtx, store, highResImages, fileName, opts, stats)
 		message = "PPTX generated successfully."
 	case ImagesZip:
-		path, size, err = ConvertURLsToZip(highResImages, docShort+".zip")
+		downloadURL, size, err = ConvertURLsToZip(renderCtx, store, highResImages, fileName, title, slides, opts, stats)
 		message = "IMAGES ZIP generated successfully."
+	case HTML:
+		downloadURL, size, err = ConvertURLsToHTML(renderCtx, store, highResImages, fileName, title, opts, stats)
+		message = "HTML flipbook generated successfully."
+	case ContactSheet:
+		downloadURL, size, err = ConvertURLsToContactSheet(renderCtx, store, highResImages, fileName, opts, stats)
+		message = "Contact sheet generated successfully."
+	case DOCX:
+		downloadURL, size, err = ConvertURLsToDOCX(renderCtx, store, highResImages, fileName, opts, stats)
+		message = "DOCX generated successfully."
+	case TIFF:
+		downloadURL, size, err = ConvertURLsToTIFF(renderCtx, store, highResImages, fileName, opts, stats)
+		message = "TIFF generated successfully."
 	default:
-		return nil, &CustomAPIError{StatusCode: 400, Detail: "Unsupported conversion type"}
+		err = &CustomAPIError{StatusCode: 400, Code: CodeInvalidParams, Detail: "Unsupported conversion type"}
 	}
 
+	// An expired request gets its timeout error, not a result nobody reads
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	renderSpan.SetAttributes(attribute.Int64("size", size))
+	endSpan(renderSpan, err)
 	if err != nil {
+		logger.Error("conversion failed", "slides", len(highResImages), "error", err)
 		return nil, err
 	}
+	logger.Info("output uploaded", "file_name", fileName, "size", size, "download_url", downloadURL, "slides", len(highResImages))
+
+	stats.setOutputSize(size)
+
+	data := map[string]interface{}{
+		"thumbnail":            thumbnail,
+		"quality":              qualityType,
+		"effective_quality":    effectiveQuality,
+		"width":                targetWidth,
+		"conversion_type":      conversionType,
+		"slides_download_link": downloadURL,
+		"file_name":            fileName,
+		"size":                 size,
+		"title":                title,
+	}
+	if expiresAt := linkExpiry.earliest(); !expiresAt.IsZero() {
+		data["link_expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	if opts.Storage == nil {
+		data["storage_backend"] = opts.storageBackend()
+	}
+	for key, value := range metadata {
+		data[key] = value
+	}
+	if opts.SlideIndex {
+		index := buildSlideIndex(slides, highResImages, max(opts.From, 1), stats)
+		indexURL, err := uploadSlideIndex(ctx, store, index, title, buildRemotePath(sanitizeFilename(docShort+".index", ".json"), opts))
+		if err != nil {
+			return nil, err
+		}
+		data["slide_index_link"] = indexURL
+	}
+
+	data["filtered_slides"] = stats.filteredCount()
+	data["cached"] = false
+	statsData := stats.toMap()
+	if cache != nil {
+		cache.Set(cacheKey, CachedConversion{
+			Data:           copyResultData(data),
+			Stats:          statsData,
+			DeckSlides:     len(slides),
+			StorageBackend: opts.storageBackend(),
+			RemotePaths:    uploads.list(),
+		})
+	}
+	if opts.IncludeStats {
+		data["stats"] = statsData
+	}
 
-	fileName := filepath.Base(path)
-	baseURL := os.Getenv("BASE_URL")
+	notifyByEmail(ctx, opts, data)
 
 	return map[string]interface{}{
 		"success": true,
 		"message": message,
-		"data": map[string]interface{}{
-			"thumbnail":            thumbnail,
-			"quality":              qualityType,
-			"conversion_type":      conversionType,
-			"slides_download_link": fmt.Sprintf("%s/%s", baseURL, path),
-			"file_name":            fileName,
-			"size":                 size,
-			"title":                title,
-		},
+		"data":    data,
 	}, nil
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConversionStats accumulates resource usage for a single conversion.
+// Counters are atomic because images are fetched concurrently.
+type ConversionStats struct {
+	bytesDownloaded atomic.Int64
+	imagesFetched   atomic.Int64
+	outputSize      atomic.Int64
+	startedAt       time.Time
+
+	mu       sync.Mutex
+	dims     map[string]image.Point
+	filtered map[string]bool
+}
+
+func newConversionStats() *ConversionStats {
+	return &ConversionStats{
+		startedAt: time.Now(),
+		dims:      make(map[string]image.Point),
+		filtered:  make(map[string]bool),
+	}
+}
+
+// markFiltered records that the image at url was dropped as a non-slide
+func (s *ConversionStats) markFiltered(url string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.filtered[url] = true
+	s.mu.Unlock()
+}
+
+// isFiltered reports whether the image at url was dropped as a non-slide
+func (s *ConversionStats) isFiltered(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.filtered[url]
+}
+
+// filteredCount returns how many distinct images were dropped as non-slides
+func (s *ConversionStats) filteredCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.filtered)
+}
+
+// recordDimensions remembers the decoded pixel size of the image at url
+func (s *ConversionStats) recordDimensions(url string, width, height int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.dims[url] = image.Point{X: width, Y: height}
+	s.mu.Unlock()
+}
+
+// dimensions returns the decoded pixel size recorded for url, if any
+func (s *ConversionStats) dimensions(url string) (image.Point, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.dims[url]
+	return p, ok
+}
+
+// addImage records a successfully downloaded image of n bytes
+func (s *ConversionStats) addImage(n int) {
+	if s == nil {
+		return
+	}
+	s.bytesDownloaded.Add(int64(n))
+	s.imagesFetched.Add(1)
+}
+
+// setOutputSize records the size of the generated output file
+func (s *ConversionStats) setOutputSize(n int64) {
+	if s == nil {
+		return
+	}
+	s.outputSize.Store(n)
+}
+
+// toMap renders the stats for the JSON response
+func (s *ConversionStats) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"bytes_downloaded":   s.bytesDownloaded.Load(),
+		"images_fetched":     s.imagesFetched.Load(),
+		"output_size":        s.outputSize.Load(),
+		"processing_time_ms": time.Since(s.startedAt).Milliseconds(),
+	}
+}
@@ -0,0 +1,1195 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jlaffaye/ftp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Storage uploads finished outputs and returns where clients can download them
+type Storage interface {
+	// Upload stops and returns ctx's error once ctx is done
+	Upload(ctx context.Context, localPath, remotePath string) (publicURL string, size int64, err error)
+	// SignedURL returns a link to remotePath valid for ttl and when it
+	// expires. Backends that can't sign return their plain public link and
+	// a zero time, it never expires.
+	SignedURL(remotePath string, ttl time.Duration) (link string, expiresAt time.Time, err error)
+	// Check verifies the backend is reachable with valid credentials
+	Check(ctx context.Context) error
+}
+
+// plainLinks is the SignedURL of backends serving files under baseURL
+// without any way to sign them
+type plainLinks struct {
+	baseURL string
+}
+
+func (l plainLinks) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	return fmt.Sprintf("%s/%s", l.baseURL, remotePath), time.Time{}, nil
+}
+
+// linkExpiry records when the first of the signed links a store handed out
+// expires, zero while every link is plain
+type linkExpiry struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+func (e *linkExpiry) add(expiresAt time.Time) {
+	if expiresAt.IsZero() {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.at.IsZero() || expiresAt.Before(e.at) {
+		e.at = expiresAt
+	}
+}
+
+// earliest returns the first expiry recorded, zero if none was
+func (e *linkExpiry) earliest() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.at
+}
+
+// signingStorage replaces the links uploads return with SignedURL ones valid for ttl
+type signingStorage struct {
+	Storage
+	ttl    time.Duration
+	expiry *linkExpiry
+}
+
+func (s signingStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	_, size, err := s.Storage.Upload(ctx, localPath, remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	signedURL, err := s.sign(remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	return signedURL, size, nil
+}
+
+// sign returns the signed link to remotePath
+func (s signingStorage) sign(remotePath string) (string, error) {
+	signedURL, expiresAt, err := s.Storage.SignedURL(remotePath, s.ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign link: %w", err)
+	}
+	s.expiry.add(expiresAt)
+	return signedURL, nil
+}
+
+// signingStreamStorage is a signingStorage for backends that stream uploads
+type signingStreamStorage struct {
+	signingStorage
+	streamer streamUploader
+}
+
+func (s signingStreamStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	if _, err := s.streamer.UploadStream(ctx, r, remotePath); err != nil {
+		return "", err
+	}
+	return s.sign(remotePath)
+}
+
+// withSignedLinks wraps store so uploads return links valid for ttl, keeping
+// its streaming support. The returned linkExpiry tells when the first of
+// them expires. A zero ttl returns store as-is.
+func withSignedLinks(store Storage, ttl time.Duration) (Storage, *linkExpiry) {
+	expiry := &linkExpiry{}
+	if ttl <= 0 {
+		return store, expiry
+	}
+	wrapped := signingStorage{Storage: store, ttl: ttl, expiry: expiry}
+	if streamer, ok := store.(streamUploader); ok {
+		return signingStreamStorage{signingStorage: wrapped, streamer: streamer}, expiry
+	}
+	return wrapped, expiry
+}
+
+// uploadRecord collects the remote paths a store wrote, so a cached
+// conversion knows which files are behind its links
+type uploadRecord struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *uploadRecord) add(remotePath string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paths = append(r.paths, remotePath)
+}
+
+// list returns the recorded paths in upload order
+func (r *uploadRecord) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.paths)
+}
+
+// recordingStorage notes the remote path of every successful upload
+type recordingStorage struct {
+	Storage
+	record *uploadRecord
+}
+
+func (s recordingStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	publicURL, size, err := s.Storage.Upload(ctx, localPath, remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	s.record.add(remotePath)
+	return publicURL, size, nil
+}
+
+// recordingStreamStorage is a recordingStorage for backends that stream uploads
+type recordingStreamStorage struct {
+	recordingStorage
+	streamer streamUploader
+}
+
+func (s recordingStreamStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	publicURL, err := s.streamer.UploadStream(ctx, r, remotePath)
+	if err != nil {
+		return "", err
+	}
+	s.record.add(remotePath)
+	return publicURL, nil
+}
+
+// withUploadRecord wraps store so the returned uploadRecord lists what it
+// uploaded, keeping its streaming support
+func withUploadRecord(store Storage) (Storage, *uploadRecord) {
+	record := &uploadRecord{}
+	wrapped := recordingStorage{Storage: store, record: record}
+	if streamer, ok := store.(streamUploader); ok {
+		return recordingStreamStorage{recordingStorage: wrapped, streamer: streamer}, record
+	}
+	return wrapped, record
+}
+
+// remover is implemented by backends that can delete an uploaded file
+type remover interface {
+	Remove(ctx context.Context, remotePath string) error
+}
+
+// streamUploader is implemented by backends that can store an output while it
+// is still being written, without a local copy. The caller counts the bytes.
+type streamUploader interface {
+	UploadStream(ctx context.Context, r io.Reader, remotePath string) (publicURL string, err error)
+}
+
+// contextReader fails reads once ctx is done, so backends whose clients
+// take no context still stop a cancelled upload at the next chunk
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+var (
+	storageOnce    sync.Once
+	defaultStorage Storage
+	storageErr     error
+)
+
+// getStorage returns the backend selected by STORAGE_BACKEND ("ftp", "sftp",
+// "s3", "gcs", "azblob" or "local"),
+// created once on first use
+func getStorage() (Storage, error) {
+	storageOnce.Do(func() {
+		defaultStorage, storageErr = newStorageFromEnv()
+	})
+	return defaultStorage, storageErr
+}
+
+// newStorageFromEnv builds the backend named by STORAGE_BACKEND, defaulting to FTP
+func newStorageFromEnv() (Storage, error) {
+	return newStorageBackend(defaultStorageBackend())
+}
+
+// defaultStorageBackend returns the backend named by STORAGE_BACKEND, ftp when unset
+func defaultStorageBackend() string {
+	if backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))); backend != "" {
+		return backend
+	}
+	return "ftp"
+}
+
+// enabledStorageBackends returns the backends the storage param may pick:
+// the default, then those listed in the comma-separated STORAGE_BACKENDS
+func enabledStorageBackends() []string {
+	backends := []string{defaultStorageBackend()}
+	for _, backend := range strings.Split(os.Getenv("STORAGE_BACKENDS"), ",") {
+		backend = strings.ToLower(strings.TrimSpace(backend))
+		if backend != "" && !slices.Contains(backends, backend) {
+			backends = append(backends, backend)
+		}
+	}
+	return backends
+}
+
+// namedStorage holds the backends requests picked with the storage param
+var namedStorage = struct {
+	sync.Mutex
+	stores map[string]Storage
+}{stores: make(map[string]Storage)}
+
+// getNamedStorage returns the backend called name, created on first use. An
+// empty name or the default one is getStorage's backend. Failed setups are
+// retried by the next request.
+func getNamedStorage(name string) (Storage, error) {
+	if name == "" || name == defaultStorageBackend() {
+		return getStorage()
+	}
+	namedStorage.Lock()
+	defer namedStorage.Unlock()
+	if store, ok := namedStorage.stores[name]; ok {
+		return store, nil
+	}
+	store, err := newStorageBackend(name)
+	if err != nil {
+		return nil, err
+	}
+	namedStorage.stores[name] = store
+	return store, nil
+}
+
+// storageBackend names the backend a conversion with o uploads to
+func (o ConversionOptions) storageBackend() string {
+	if o.StorageBackend != "" {
+		return o.StorageBackend
+	}
+	return defaultStorageBackend()
+}
+
+// newStorageBackend builds the backend called name from its env settings
+func newStorageBackend(backend string) (Storage, error) {
+	switch backend {
+	case "ftp":
+		return newFTPStorage()
+	case "s3":
+		return newS3Storage()
+	case "sftp":
+		return newSFTPStorage()
+	case "gcs":
+		return newGCSStorage()
+	case "azblob":
+		return newAzblobStorage()
+	case "local":
+		return newLocalStorage()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
+
+// defaultFTPPoolSize caps idle pooled FTP connections when FTP_POOL_SIZE is unset
+const defaultFTPPoolSize = 4
+
+// ftpStorage uploads to an FTP server whose files are served under BASE_URL.
+// Logged-in connections are kept in a small pool and reused across uploads.
+type ftpStorage struct {
+	host string
+	port int
+	user string
+	pass string
+	plainLinks
+	pool chan *ftp.ServerConn
+	// tlsConfig enables explicit FTPS (AUTH TLS) when set
+	tlsConfig *tls.Config
+}
+
+// newFTPStorage reads FTP_HOST, FTP_PORT, FTP_USER, FTP_PASS, FTP_POOL_SIZE
+// and BASE_URL. FTP_TLS=true switches to explicit TLS, and
+// FTP_TLS_INSECURE_SKIP_VERIFY=true accepts self-signed server certificates.
+func newFTPStorage() (*ftpStorage, error) {
+	ftpPortStr := os.Getenv("FTP_PORT")
+	if ftpPortStr == "" {
+		ftpPortStr = "21"
+	}
+	ftpPort, err := strconv.Atoi(ftpPortStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FTP_PORT %q", ftpPortStr)
+	}
+
+	poolSize := defaultFTPPoolSize
+	if v, err := strconv.Atoi(os.Getenv("FTP_POOL_SIZE")); err == nil && v >= 0 {
+		poolSize = v
+	}
+
+	storage := &ftpStorage{
+		host:       os.Getenv("FTP_HOST"),
+		port:       ftpPort,
+		user:       os.Getenv("FTP_USER"),
+		pass:       os.Getenv("FTP_PASS"),
+		plainLinks: plainLinks{baseURL: os.Getenv("BASE_URL")},
+		pool:       make(chan *ftp.ServerConn, poolSize),
+	}
+
+	useTLS, err := envBool("FTP_TLS")
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		insecure, err := envBool("FTP_TLS_INSECURE_SKIP_VERIFY")
+		if err != nil {
+			return nil, err
+		}
+		storage.tlsConfig = &tls.Config{
+			ServerName:         storage.host,
+			InsecureSkipVerify: insecure,
+			MinVersion:         tls.VersionTLS12,
+		}
+	}
+	return storage, nil
+}
+
+// envBool parses a boolean env var, where unset means false
+func envBool(name string) (bool, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: must be true or false", name, value)
+	}
+	return b, nil
+}
+
+// dial opens and logs in a new FTP connection
+func (s *ftpStorage) dial(opts ...ftp.DialOption) (*ftp.ServerConn, error) {
+	if s.tlsConfig != nil {
+		opts = append(opts, ftp.DialWithExplicitTLS(s.tlsConfig))
+	}
+
+	conn, err := ftp.Dial(fmt.Sprintf("%s:%d", s.host, s.port), opts...)
+	if err != nil {
+		if s.tlsConfig != nil {
+			return nil, fmt.Errorf("FTPS connection failed (is explicit TLS enabled on the server?): %w", err)
+		}
+		return nil, err
+	}
+
+	err = conn.Login(s.user, s.pass)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// acquire returns a pooled connection that still answers NOOP, or dials a
+// new one. Stale pooled connections are dropped.
+func (s *ftpStorage) acquire() (*ftp.ServerConn, error) {
+	for {
+		select {
+		case conn := <-s.pool:
+			if conn.NoOp() == nil {
+				return conn, nil
+			}
+			conn.Quit()
+		default:
+			return s.dial(ftp.DialWithTimeout(10 * time.Second))
+		}
+	}
+}
+
+// release returns a healthy connection to the pool, closing it when the pool is full
+func (s *ftpStorage) release(conn *ftp.ServerConn) {
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Quit()
+	}
+}
+
+// Upload uploads a file to the FTP server, creating remote directories as needed
+func (s *ftpStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	publicURL, err := s.UploadStream(ctx, file, remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	return publicURL, fileInfo.Size(), nil
+}
+
+// UploadStream stores everything read from r at remotePath on a pooled connection
+func (s *ftpStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	conn, err := s.acquire()
+	if err != nil {
+		return "", err
+	}
+
+	if stored, err := s.upload(conn, contextReader{ctx: ctx, r: r}, remotePath); err != nil {
+		// The connection may be mid-transfer or in an unknown directory
+		conn.Quit()
+		if stored {
+			s.removePartial(ctx, remotePath)
+		}
+		return "", err
+	}
+	s.release(conn)
+	return fmt.Sprintf("%s/%s", s.baseURL, remotePath), nil
+}
+
+// removePartial deletes what a failed transfer left at remotePath, on a
+// fresh connection since the failed one is gone. ctx only tags the log, the
+// cleanup runs even when the upload was cancelled.
+func (s *ftpStorage) removePartial(ctx context.Context, remotePath string) {
+	conn, err := s.acquire()
+	if err != nil {
+		return
+	}
+	if err := conn.Delete("/" + remotePath); err != nil {
+		loggerFrom(ctx).Warn("failed to remove partial upload", "remote_path", remotePath, "error", err)
+	}
+	s.release(conn)
+}
+
+// Remove deletes the file at remotePath on a pooled connection
+func (s *ftpStorage) Remove(ctx context.Context, remotePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	if err := conn.Delete("/" + remotePath); err != nil {
+		conn.Quit()
+		return err
+	}
+	s.release(conn)
+	return nil
+}
+
+// upload stores one file on conn, starting from the root directory since
+// pooled connections may be left anywhere by a previous upload. stored
+// reports whether the transfer started, so a partial file may exist.
+func (s *ftpStorage) upload(conn *ftp.ServerConn, r io.Reader, remotePath string) (stored bool, err error) {
+	// Create directories if needed
+	dirs := strings.Split(remotePath, "/")
+	remoteDir := strings.Join(dirs[:len(dirs)-1], "/")
+	remoteFile := dirs[len(dirs)-1]
+
+	err = conn.ChangeDir("/")
+	if err != nil {
+		return false, err
+	}
+
+	for _, dir := range strings.Split(remoteDir, "/") {
+		if dir == "" {
+			continue
+		}
+		err = conn.ChangeDir(dir)
+		if err != nil {
+			err = conn.MakeDir(dir)
+			if err != nil {
+				return false, err
+			}
+			err = conn.ChangeDir(dir)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	// Upload file
+	return true, conn.Stor(remoteFile, r)
+}
+
+// Check connects and logs in with a fresh connection, without touching any files
+func (s *ftpStorage) Check(ctx context.Context) error {
+	conn, err := s.dial(ftp.DialWithContext(ctx))
+	if err != nil {
+		return err
+	}
+	return conn.Quit()
+}
+
+// sftpStorage uploads over SSH to a server whose files are served under BASE_URL
+type sftpStorage struct {
+	addr   string
+	config *ssh.ClientConfig
+	plainLinks
+}
+
+// newSFTPStorage reads SFTP_HOST, SFTP_PORT, SFTP_USER and either SFTP_PASS
+// or SFTP_KEY_PATH (with optional SFTP_KEY_PASSPHRASE). The server's host key
+// is verified against SFTP_KNOWN_HOSTS, or a single pinned SFTP_HOST_KEY line
+// in authorized_keys format.
+func newSFTPStorage() (*sftpStorage, error) {
+	host := os.Getenv("SFTP_HOST")
+	if host == "" {
+		return nil, fmt.Errorf("SFTP_HOST is required for the sftp storage backend")
+	}
+	port := os.Getenv("SFTP_PORT")
+	if port == "" {
+		port = "22"
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return nil, fmt.Errorf("invalid SFTP_PORT %q", port)
+	}
+
+	var auth []ssh.AuthMethod
+	if keyPath := os.Getenv("SFTP_KEY_PATH"); keyPath != "" {
+		key, err := os.ReadFile(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SFTP_KEY_PATH: %w", err)
+		}
+		var signer ssh.Signer
+		if passphrase := os.Getenv("SFTP_KEY_PASSPHRASE"); passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SFTP_KEY_PATH: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if pass := os.Getenv("SFTP_PASS"); pass != "" {
+		auth = append(auth, ssh.Password(pass))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SFTP_PASS or SFTP_KEY_PATH is required for the sftp storage backend")
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpStorage{
+		addr: fmt.Sprintf("%s:%s", host, port),
+		config: &ssh.ClientConfig{
+			User:            os.Getenv("SFTP_USER"),
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+		plainLinks: plainLinks{baseURL: os.Getenv("BASE_URL")},
+	}, nil
+}
+
+// sftpHostKeyCallback pins SFTP_HOST_KEY when set, otherwise checks SFTP_KNOWN_HOSTS
+func sftpHostKeyCallback() (ssh.HostKeyCallback, error) {
+	if pinned := strings.TrimSpace(os.Getenv("SFTP_HOST_KEY")); pinned != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SFTP_HOST_KEY: %w", err)
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+	if knownHosts := os.Getenv("SFTP_KNOWN_HOSTS"); knownHosts != "" {
+		callback, err := knownhosts.New(knownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SFTP_KNOWN_HOSTS: %w", err)
+		}
+		return callback, nil
+	}
+	return nil, fmt.Errorf("SFTP_HOST_KEY or SFTP_KNOWN_HOSTS is required to verify the sftp server")
+}
+
+// dial opens an SSH connection and an SFTP session on top of it
+func (s *sftpStorage) dial() (*ssh.Client, *sftp.Client, error) {
+	conn, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, client, nil
+}
+
+// Upload uploads a file over SFTP, creating remote directories as needed
+func (s *sftpStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	publicURL, size, err := s.put(ctx, file, remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	return publicURL, size, nil
+}
+
+// UploadStream writes everything read from r to remotePath over SFTP
+func (s *sftpStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	publicURL, _, err := s.put(ctx, r, remotePath)
+	return publicURL, err
+}
+
+// put copies r into remotePath on a fresh session, creating remote directories as needed
+func (s *sftpStorage) put(ctx context.Context, r io.Reader, remotePath string) (string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, err
+	}
+	conn, client, err := s.dial()
+	if err != nil {
+		return "", 0, err
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	if dir := path.Dir(remotePath); dir != "." {
+		if err := client.MkdirAll(dir); err != nil {
+			return "", 0, err
+		}
+	}
+
+	remoteFile, err := client.Create(remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+
+	size, err := remoteFile.ReadFrom(contextReader{ctx: ctx, r: r})
+	if closeErr := remoteFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a truncated file behind the link
+		if removeErr := client.Remove(remotePath); removeErr != nil {
+			loggerFrom(ctx).Warn("failed to remove partial upload", "remote_path", remotePath, "error", removeErr)
+		}
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("%s/%s", s.baseURL, remotePath), size, nil
+}
+
+// Remove deletes remotePath on a fresh session
+func (s *sftpStorage) Remove(ctx context.Context, remotePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	conn, client, err := s.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer client.Close()
+
+	return client.Remove(remotePath)
+}
+
+// Check opens an SFTP session and stats the login directory
+func (s *sftpStorage) Check(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		conn, client, err := s.dial()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+		defer client.Close()
+
+		_, err = client.Stat(".")
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// defaultOutputDir holds local outputs when OUTPUT_DIR is unset
+const defaultOutputDir = "output"
+
+// localStorage writes outputs into a local directory served by GET /files/*
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+// newLocalStorage reads OUTPUT_DIR, created if missing, and BASE_URL, the
+// public address of this app. Without BASE_URL the returned links are
+// relative /files/ paths.
+func newLocalStorage() (*localStorage, error) {
+	dir := os.Getenv("OUTPUT_DIR")
+	if dir == "" {
+		dir = defaultOutputDir
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OUTPUT_DIR: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create OUTPUT_DIR: %w", err)
+	}
+
+	return &localStorage{dir: dir, baseURL: strings.TrimRight(os.Getenv("BASE_URL"), "/")}, nil
+}
+
+// Upload copies the file into the output directory
+func (s *localStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	return s.put(ctx, file, remotePath)
+}
+
+// UploadStream writes everything read from r into the output directory
+func (s *localStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	publicURL, _, err := s.put(ctx, r, remotePath)
+	return publicURL, err
+}
+
+// put writes r to a temp file next to its destination and renames it into
+// place, so /files never serves a partial output
+func (s *localStorage) put(ctx context.Context, r io.Reader, remotePath string) (string, int64, error) {
+	dst, err := s.resolve(remotePath)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", 0, err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(tmpFile, contextReader{ctx: ctx, r: r})
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", 0, err
+	}
+
+	publicURL, _, err := s.SignedURL(remotePath, 0)
+	return publicURL, size, err
+}
+
+// SignedURL returns the plain /files link, local outputs are served as long
+// as they exist
+func (s *localStorage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	dst, err := s.resolve(remotePath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	rel, _ := filepath.Rel(s.dir, dst)
+	return fmt.Sprintf("%s/files/%s", s.baseURL, filepath.ToSlash(rel)), time.Time{}, nil
+}
+
+// Remove deletes the output at remotePath
+func (s *localStorage) Remove(ctx context.Context, remotePath string) error {
+	dst, err := s.resolve(remotePath)
+	if err != nil {
+		return err
+	}
+	return os.Remove(dst)
+}
+
+// resolve maps a slash-separated path onto the output directory, rejecting
+// paths that would escape it
+func (s *localStorage) resolve(remotePath string) (string, error) {
+	cleaned := path.Clean("/" + remotePath)
+	if cleaned == "/" || strings.HasPrefix(path.Base(cleaned), ".") || strings.Contains(remotePath, "\\") {
+		return "", fmt.Errorf("invalid path %q", remotePath)
+	}
+	full := filepath.Join(s.dir, filepath.FromSlash(cleaned))
+	if rel, err := filepath.Rel(s.dir, full); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid path %q", remotePath)
+	}
+	return full, nil
+}
+
+// Check verifies the output directory exists and is writable
+func (s *localStorage) Check(ctx context.Context) error {
+	tmpFile, err := os.CreateTemp(s.dir, ".check-*")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	return os.Remove(tmpFile.Name())
+}
+
+// s3Storage uploads to an S3 (or S3-compatible) bucket
+type s3Storage struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	bucket    string
+	region    string
+	publicURL string
+}
+
+// newS3Storage reads S3_BUCKET, S3_REGION (or AWS_REGION), optional
+// S3_ENDPOINT for S3-compatible services and S3_PUBLIC_URL for a custom
+// download base. Credentials come from the standard AWS_* env vars.
+func newS3Storage() (*s3Storage, error) {
+	bucket := os.Getenv("S3_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is required for the s3 storage backend")
+	}
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("S3_REGION or AWS_REGION is required for the s3 storage backend")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	endpoint := os.Getenv("S3_ENDPOINT")
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	publicURL := strings.TrimRight(os.Getenv("S3_PUBLIC_URL"), "/")
+	if publicURL == "" && endpoint != "" {
+		publicURL = strings.TrimRight(endpoint, "/") + "/" + bucket
+	}
+	if publicURL == "" {
+		publicURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	}
+
+	return &s3Storage{client: client, presigner: s3.NewPresignClient(client), bucket: bucket, region: region, publicURL: publicURL}, nil
+}
+
+// Upload puts the file at remotePath as the object key and returns its URL
+func (s *s3Storage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(remotePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(remotePath),
+		Body:          file,
+		ContentLength: aws.Int64(fileInfo.Size()),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("%s/%s", s.publicURL, remotePath), fileInfo.Size(), nil
+}
+
+// SignedURL presigns a GET for the object
+func (s *s3Storage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	req, err := s.presigner.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(remotePath),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return req.URL, expiresAt, nil
+}
+
+// Remove deletes the object at remotePath
+func (s *s3Storage) Remove(ctx context.Context, remotePath string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(remotePath),
+	})
+	return err
+}
+
+// Check issues a HEAD on the bucket
+func (s *s3Storage) Check(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(s.bucket)})
+	return err
+}
+
+// gcsStorage uploads to a Google Cloud Storage bucket
+type gcsStorage struct {
+	client    *gcs.Client
+	bucket    string
+	publicURL string
+}
+
+// newGCSStorage reads GCS_BUCKET and optional GCS_PUBLIC_URL for a custom
+// download base. Credentials come from GOOGLE_APPLICATION_CREDENTIALS.
+func newGCSStorage() (*gcsStorage, error) {
+	bucket := os.Getenv("GCS_BUCKET")
+	if bucket == "" {
+		return nil, fmt.Errorf("GCS_BUCKET is required for the gcs storage backend")
+	}
+
+	client, err := gcs.NewClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	publicURL := strings.TrimRight(os.Getenv("GCS_PUBLIC_URL"), "/")
+	if publicURL == "" {
+		publicURL = "https://storage.googleapis.com/" + bucket
+	}
+
+	return &gcsStorage{client: client, bucket: bucket, publicURL: publicURL}, nil
+}
+
+// Upload writes the file to the bucket with remotePath as the object name
+func (s *gcsStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	return s.put(ctx, file, remotePath)
+}
+
+// UploadStream writes everything read from r to the object at remotePath
+func (s *gcsStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	publicURL, _, err := s.put(ctx, r, remotePath)
+	return publicURL, err
+}
+
+// put streams r into the object and returns its public URL
+func (s *gcsStorage) put(ctx context.Context, r io.Reader, remotePath string) (string, int64, error) {
+	contentType := mime.TypeByExtension(path.Ext(remotePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	writer := s.client.Bucket(s.bucket).Object(remotePath).NewWriter(ctx)
+	writer.ContentType = contentType
+	size, err := io.Copy(writer, r)
+	if err != nil {
+		// Cancelling first makes Close abort the upload instead of
+		// committing a truncated object
+		cancel()
+		writer.Close()
+		return "", 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return "", 0, err
+	}
+
+	return fmt.Sprintf("%s/%s", s.publicURL, remotePath), size, nil
+}
+
+// SignedURL returns a V4 signed GET link to the object
+func (s *gcsStorage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	signedURL, err := s.client.Bucket(s.bucket).SignedURL(remotePath, &gcs.SignedURLOptions{
+		Scheme:  gcs.SigningSchemeV4,
+		Method:  "GET",
+		Expires: expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signedURL, expiresAt, nil
+}
+
+// Remove deletes the object at remotePath
+func (s *gcsStorage) Remove(ctx context.Context, remotePath string) error {
+	return s.client.Bucket(s.bucket).Object(remotePath).Delete(ctx)
+}
+
+// Check reads the bucket's attributes
+func (s *gcsStorage) Check(ctx context.Context) error {
+	_, err := s.client.Bucket(s.bucket).Attrs(ctx)
+	return err
+}
+
+// azblobStorage uploads to an Azure Blob Storage container
+type azblobStorage struct {
+	client    *azblob.Client
+	container string
+}
+
+// newAzblobStorage reads AZURE_STORAGE_CONTAINER and either
+// AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT with
+// AZURE_STORAGE_KEY. The container is created when missing.
+func newAzblobStorage() (*azblobStorage, error) {
+	container := os.Getenv("AZURE_STORAGE_CONTAINER")
+	if container == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_CONTAINER is required for the azblob storage backend")
+	}
+
+	var client *azblob.Client
+	var err error
+	if connStr := os.Getenv("AZURE_STORAGE_CONNECTION_STRING"); connStr != "" {
+		client, err = azblob.NewClientFromConnectionString(connStr, nil)
+	} else {
+		account := os.Getenv("AZURE_STORAGE_ACCOUNT")
+		if account == "" || os.Getenv("AZURE_STORAGE_KEY") == "" {
+			return nil, fmt.Errorf("AZURE_STORAGE_CONNECTION_STRING or AZURE_STORAGE_ACCOUNT and AZURE_STORAGE_KEY are required for the azblob storage backend")
+		}
+		var cred *azblob.SharedKeyCredential
+		cred, err = azblob.NewSharedKeyCredential(account, os.Getenv("AZURE_STORAGE_KEY"))
+		if err == nil {
+			client, err = azblob.NewClientWithSharedKeyCredential(fmt.Sprintf("https://%s.blob.core.windows.net/", account), cred, nil)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := client.CreateContainer(ctx, container, nil); err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+		return nil, fmt.Errorf("failed to create container %q: %w", container, err)
+	}
+
+	return &azblobStorage{client: client, container: container}, nil
+}
+
+// Upload puts the file at remotePath as the blob name and returns its URL
+func (s *azblobStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err = s.client.UploadFile(ctx, s.container, remotePath, file, &azblob.UploadFileOptions{HTTPHeaders: blobHeaders(remotePath)})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return s.blobClient(remotePath).URL(), fileInfo.Size(), nil
+}
+
+// UploadStream uploads everything read from r as the blob at remotePath
+func (s *azblobStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	_, err := s.client.UploadStream(ctx, s.container, remotePath, r, &azblob.UploadStreamOptions{HTTPHeaders: blobHeaders(remotePath)})
+	if err != nil {
+		return "", err
+	}
+	return s.blobClient(remotePath).URL(), nil
+}
+
+// blobHeaders sets the blob's content type from its extension
+func blobHeaders(remotePath string) *blob.HTTPHeaders {
+	contentType := mime.TypeByExtension(path.Ext(remotePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &blob.HTTPHeaders{BlobContentType: &contentType}
+}
+
+// blobClient addresses the blob at remotePath
+func (s *azblobStorage) blobClient(remotePath string) *blob.Client {
+	return s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(remotePath)
+}
+
+// SignedURL returns the blob's URL with a read-only SAS token. It needs a
+// shared key, from AZURE_STORAGE_KEY or the connection string.
+func (s *azblobStorage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	signedURL, err := s.blobClient(remotePath).GetSASURL(sas.BlobPermissions{Read: true}, expiresAt, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signedURL, expiresAt, nil
+}
+
+// Remove deletes the blob at remotePath
+func (s *azblobStorage) Remove(ctx context.Context, remotePath string) error {
+	_, err := s.client.DeleteBlob(ctx, s.container, remotePath, nil)
+	return err
+}
+
+// Check reads the container's properties
+func (s *azblobStorage) Check(ctx context.Context) error {
+	_, err := s.client.ServiceClient().NewContainerClient(s.container).GetProperties(ctx, nil)
+	return err
+}
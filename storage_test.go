@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStorage keeps uploads in memory and links them under memory://
+type memoryStorage struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	uploads int
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *memoryStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return "", 0, err
+	}
+	data, err := os.ReadFile(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[remotePath] = data
+	s.uploads++
+	return "memory://" + remotePath, int64(len(data)), nil
+}
+
+// SignedURL returns the plain memory:// link, memoryStorage can't sign
+func (s *memoryStorage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	return "memory://" + remotePath, time.Time{}, nil
+}
+
+func (s *memoryStorage) Check(ctx context.Context) error {
+	return nil
+}
+
+// file returns the upload stored at remotePath
+func (s *memoryStorage) file(remotePath string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[remotePath]
+	return data, ok
+}
+
+// uploadCount returns how many uploads were stored
+func (s *memoryStorage) uploadCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uploads
+}
+
+// cancellingReader serves endless data and cancels the upload after its
+// first chunk, like a client going away mid-transfer
+type cancellingReader struct {
+	cancel context.CancelFunc
+	reads  int
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.reads++
+	if r.reads > 1 {
+		r.cancel()
+	}
+	return len(p), nil
+}
+
+func TestLocalStorageStopsWhenCancelled(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "out.pdf")
+	if err := os.WriteFile(src, bytes.Repeat([]byte("x"), 1<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		upload func(ctx context.Context, cancel context.CancelFunc, store *localStorage) error
+	}{
+		{"Upload", func(ctx context.Context, cancel context.CancelFunc, store *localStorage) error {
+			cancel()
+			_, _, err := store.Upload(ctx, src, "deck/out.pdf")
+			return err
+		}},
+		{"UploadStream", func(ctx context.Context, cancel context.CancelFunc, store *localStorage) error {
+			_, err := store.UploadStream(ctx, &cancellingReader{cancel: cancel}, "deck/out.pdf")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &localStorage{dir: t.TempDir()}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if err := tt.upload(ctx, cancel, store); !errors.Is(err, context.Canceled) {
+				t.Fatalf("err = %v, want context.Canceled", err)
+			}
+			entries, err := os.ReadDir(filepath.Join(store.dir, "deck"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("cancelled upload left %d files behind", len(entries))
+			}
+		})
+	}
+}
+
+func TestContextReaderStopsOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := contextReader{ctx: ctx, r: bytes.NewReader([]byte("slides"))}
+
+	buf := make([]byte, 3)
+	if n, err := r.Read(buf); n != 3 || err != nil {
+		t.Fatalf("Read before cancel = %d, %v", n, err)
+	}
+	cancel()
+	if _, err := io.ReadAll(r); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read after cancel: err = %v, want context.Canceled", err)
+	}
+}
+
+// signingMemoryStorage is a memoryStorage that signs its links like the
+// object store backends do
+type signingMemoryStorage struct {
+	*memoryStorage
+}
+
+func (s signingMemoryStorage) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ttl)
+	return fmt.Sprintf("memory://%s?expires=%d", remotePath, expiresAt.Unix()), expiresAt, nil
+}
+
+// withLinkTTL sets LINK_TTL's parsed value for the rest of the test
+func withLinkTTL(t *testing.T, ttl time.Duration) {
+	t.Helper()
+	saved := linkTTL
+	linkTTL = ttl
+	t.Cleanup(func() { linkTTL = saved })
+}
+
+func TestWithSignedLinks(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "out.pdf")
+	if err := os.WriteFile(src, []byte("%PDF"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		store      Storage
+		ttl        time.Duration
+		wantSigned bool
+	}{
+		{"plain backend", newMemoryStorage(), time.Hour, false},
+		{"signing backend without LINK_TTL", signingMemoryStorage{newMemoryStorage()}, 0, false},
+		{"signing backend", signingMemoryStorage{newMemoryStorage()}, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, expiry := withSignedLinks(tt.store, tt.ttl)
+			before := time.Now()
+			link, _, err := store.Upload(context.Background(), src, "pdf/deck/out.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if signed := strings.Contains(link, "?expires="); signed != tt.wantSigned {
+				t.Errorf("link = %q, signed = %v, want %v", link, signed, tt.wantSigned)
+			}
+			expiresAt := expiry.earliest()
+			if !tt.wantSigned {
+				if !expiresAt.IsZero() {
+					t.Errorf("plain link reported expiry %v", expiresAt)
+				}
+				return
+			}
+			if expiresAt.Before(before.Add(tt.ttl)) || expiresAt.After(time.Now().Add(tt.ttl)) {
+				t.Errorf("expiry = %v, want %v from the upload", expiresAt, tt.ttl)
+			}
+		})
+	}
+}
+
+func TestConversionReportsLinkExpiry(t *testing.T) {
+	withLinkTTL(t, time.Hour)
+	tests := []struct {
+		name       string
+		store      Storage
+		wantSigned bool
+	}{
+		{"plain backend", newMemoryStorage(), false},
+		{"signing backend", signingMemoryStorage{newMemoryStorage()}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeSlideShare(t, 2)
+			withStorage(t, tt.store)
+			withConversionCache(t)
+
+			data := convertData(t, fake.deckURL(t), PDF, ConversionOptions{Client: fake.client()})
+			link, _ := data["slides_download_link"].(string)
+			value, hasExpiry := data["link_expires_at"].(string)
+			if !tt.wantSigned {
+				if hasExpiry || strings.Contains(link, "?expires=") {
+					t.Errorf("plain backend returned %q expiring %q", link, value)
+				}
+				return
+			}
+
+			expiresAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				t.Fatalf("link_expires_at = %q: %v", value, err)
+			}
+			if want := fmt.Sprintf("?expires=%d", expiresAt.Unix()); !strings.HasSuffix(link, want) {
+				t.Errorf("link = %q, want it to expire at link_expires_at %s", link, value)
+			}
+		})
+	}
+}
+
+func TestEnabledStorageBackends(t *testing.T) {
+	tests := []struct {
+		name     string
+		backend  string
+		backends string
+		want     []string
+	}{
+		{name: "unset", want: []string{"ftp"}},
+		{name: "default only", backend: "S3", want: []string{"s3"}},
+		{name: "extra backends", backend: "s3", backends: "ftp, local", want: []string{"s3", "ftp", "local"}},
+		{name: "default listed again", backend: "s3", backends: "s3,ftp,,FTP", want: []string{"s3", "ftp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STORAGE_BACKEND", tt.backend)
+			t.Setenv("STORAGE_BACKENDS", tt.backends)
+			if got := enabledStorageBackends(); !slices.Equal(got, tt.want) {
+				t.Errorf("enabledStorageBackends() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionUploadsToRequestedStorage(t *testing.T) {
+	fake := newFakeSlideShare(t, 2)
+	defaultStore := newMemoryStorage()
+	withStorage(t, defaultStore)
+	withConversionCache(t)
+	outputDir := t.TempDir()
+	t.Setenv("STORAGE_BACKEND", "")
+	t.Setenv("STORAGE_BACKENDS", "local")
+	t.Setenv("OUTPUT_DIR", outputDir)
+	t.Setenv("BASE_URL", "")
+	t.Cleanup(func() {
+		namedStorage.Lock()
+		delete(namedStorage.stores, "local")
+		namedStorage.Unlock()
+	})
+
+	tests := []struct {
+		name        string
+		backend     string
+		wantBackend string
+		wantPrefix  string
+	}{
+		{"default backend", "", "ftp", "memory://"},
+		{"requested backend", "local", "local", "/files/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := convertData(t, fake.deckURL(t), PDF, ConversionOptions{Client: fake.client(), StorageBackend: tt.backend})
+			if data["storage_backend"] != tt.wantBackend {
+				t.Errorf("storage_backend = %v, want %s", data["storage_backend"], tt.wantBackend)
+			}
+			link, _ := data["slides_download_link"].(string)
+			if !strings.HasPrefix(link, tt.wantPrefix) {
+				t.Fatalf("slides_download_link = %q, want it under %s", link, tt.wantPrefix)
+			}
+		})
+	}
+
+	if defaultStore.uploadCount() != 1 {
+		t.Errorf("default backend got %d uploads, want only its own conversion's", defaultStore.uploadCount())
+	}
+	matches, _ := filepath.Glob(filepath.Join(outputDir, "*", "*", "*", "*.pdf"))
+	if len(matches) != 1 {
+		t.Errorf("local backend holds %d PDFs, want 1", len(matches))
+	}
+}
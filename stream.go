@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Delivery modes accepted by the delivery param
+const (
+	DeliveryStorage = "storage"
+	DeliveryFTP     = "ftp"
+	DeliveryStream  = "stream"
+)
+
+// streamContentTypes lists the outputs that can be sent in the response and their media types
+var streamContentTypes = map[SlidesConversionType]string{
+	PDF:       "application/pdf",
+	PPTX:      "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	ImagesZip: "application/zip",
+}
+
+// responseCapture is a Storage that keeps the finished output on local disk
+// so the handler can write it to the response instead of uploading it
+type responseCapture struct {
+	path string
+	name string
+}
+
+// Upload takes over localPath by moving it aside, since the converters
+// remove their temp files as soon as the upload returns
+func (s *responseCapture) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	if s.path != "" {
+		return "", 0, fmt.Errorf("stream delivery produces a single file")
+	}
+
+	tmpFile, err := os.CreateTemp(tempDir, "stream-*"+path.Ext(remotePath))
+	if err != nil {
+		return "", 0, err
+	}
+	tmpFile.Close()
+
+	if err := os.Rename(localPath, tmpFile.Name()); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", 0, err
+	}
+	fileInfo, err := os.Stat(tmpFile.Name())
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", 0, err
+	}
+
+	s.path = tmpFile.Name()
+	s.name = path.Base(remotePath)
+	return "", fileInfo.Size(), nil
+}
+
+// SignedURL returns no link, the file goes out in the response
+func (s *responseCapture) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	return "", time.Time{}, nil
+}
+
+// Check always succeeds, nothing leaves the server
+func (s *responseCapture) Check(ctx context.Context) error {
+	return nil
+}
+
+// cleanup removes the captured file if it was never sent
+func (s *responseCapture) cleanup() {
+	if s.path != "" {
+		os.Remove(s.path)
+	}
+}
+
+// archiveStream is a Storage for delivery=stream IMAGES_ZIP conversions. Its
+// UploadStream hands the archive to the handler while zip.Writer is still
+// producing it and waits until the response has sent it, so the ZIP goes to
+// the client without a copy on disk.
+type archiveStream struct {
+	name    string
+	archive chan io.Reader
+	sent    chan error
+}
+
+func newArchiveStream() *archiveStream {
+	return &archiveStream{archive: make(chan io.Reader), sent: make(chan error, 1)}
+}
+
+func (s *archiveStream) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	if s.name != "" {
+		return "", fmt.Errorf("stream delivery produces a single file")
+	}
+	s.name = path.Base(remotePath)
+	select {
+	case s.archive <- r:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	select {
+	case err := <-s.sent:
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Upload sends an archive that was written to disk after all
+func (s *archiveStream) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := s.UploadStream(ctx, file, remotePath); err != nil {
+		return "", 0, err
+	}
+	return "", fileInfo.Size(), nil
+}
+
+// SignedURL returns no link, the archive goes out in the response
+func (s *archiveStream) SignedURL(remotePath string, ttl time.Duration) (string, time.Time, error) {
+	return "", time.Time{}, nil
+}
+
+// Check always succeeds, nothing leaves the server
+func (s *archiveStream) Check(ctx context.Context) error {
+	return nil
+}
+
+// errClientGone is reported when the response closed before the archive ended
+var errClientGone = errors.New("client went away before the archive was sent")
+
+// archiveBody is the response body of a streamed archive. A failed archive
+// fails its reads, so fasthttp drops the connection instead of ending the
+// chunked body and the client sees an incomplete download. How sending went
+// is reported once, at the end of the archive or when fasthttp closes the
+// body early.
+type archiveBody struct {
+	r    io.Reader
+	sent chan<- error
+	once sync.Once
+}
+
+func (b *archiveBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.report(nil)
+	} else if err != nil {
+		b.report(err)
+	}
+	return n, err
+}
+
+func (b *archiveBody) Close() error {
+	b.report(errClientGone)
+	return nil
+}
+
+func (b *archiveBody) report(err error) {
+	b.once.Do(func() { b.sent <- err })
+}
+
+// detachedContext keeps ctx's values and deadline but not its cancellation,
+// for work that outlives the handler such as sending a streamed body
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		return context.WithDeadline(detached, deadline)
+	}
+	return context.WithCancel(detached)
+}
+
+// streamArchive runs an IMAGES_ZIP conversion into an archiveStream and sends
+// the ZIP as it is written. Failures before the archive starts are answered
+// as usual, later ones abort the connection.
+func streamArchive(c *fiber.Ctx, params *ConvertParams, opts ConversionOptions) error {
+	// fasthttp sends the body after the handler returns, the conversion has
+	// to keep writing it until then
+	ctx, cancel := detachedContext(c.UserContext())
+	stream := newArchiveStream()
+	opts.Storage = stream
+
+	result := make(chan error, 1)
+	go func() {
+		defer cancel()
+		_, err := GetSlidesDownloadLink(ctx, params.URL, params.ConversionType, params.Quality, opts)
+		result <- err
+	}()
+
+	select {
+	case archive := <-stream.archive:
+		c.Attachment(stream.name)
+		c.Set(fiber.HeaderContentType, streamContentTypes[ImagesZip])
+		c.Context().SetBodyStream(&archiveBody{r: archive, sent: stream.sent}, -1)
+		return nil
+	case err := <-result:
+		if err == nil {
+			err = &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "Conversion produced no file"}
+		}
+		return err
+	}
+}
+
+// streamConversion runs the conversion into a responseCapture and writes the
+// file as an attachment, skipping storage entirely. Archives are sent while
+// they are written, see streamArchive.
+func streamConversion(c *fiber.Ctx, params *ConvertParams, opts ConversionOptions) error {
+	if params.ConversionType == ImagesZip {
+		return streamArchive(c, params, opts)
+	}
+
+	capture := &responseCapture{}
+	defer capture.cleanup()
+	opts.Storage = capture
+
+	if _, err := GetSlidesDownloadLink(c.UserContext(), params.URL, params.ConversionType, params.Quality, opts); err != nil {
+		return err
+	}
+	if capture.path == "" {
+		return &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "Conversion produced no file"}
+	}
+
+	file, err := os.Open(capture.path)
+	if err != nil {
+		return &CustomAPIError{StatusCode: 500, Code: CodeInternal, Detail: fmt.Sprintf("Failed to open output: %v", err)}
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return &CustomAPIError{StatusCode: 500, Code: CodeInternal, Detail: fmt.Sprintf("Failed to open output: %v", err)}
+	}
+
+	// From here the response owns the file and removes it when it is done
+	capture.path = ""
+
+	c.Attachment(capture.name)
+	c.Set(fiber.HeaderContentType, streamContentTypes[params.ConversionType])
+	return c.SendStream(removeOnClose{file}, int(fileInfo.Size()))
+}
+
+// removeOnClose is a streamed response body that deletes its file on Close.
+// fasthttp closes the body once it is fully written or the client is gone,
+// so the file lives exactly as long as the response needs it.
+type removeOnClose struct {
+	*os.File
+}
+
+func (f removeOnClose) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); removeErr != nil && err == nil {
+		err = removeErr
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// withTempDir points conversion temp files at a fresh directory and returns it
+func withTempDir(t *testing.T) string {
+	t.Helper()
+	saved := tempDir
+	tempDir = t.TempDir()
+	t.Cleanup(func() { tempDir = saved })
+	return tempDir
+}
+
+// waitForEmptyDir polls dir until it is empty or timeout passes and returns
+// what is left
+func waitForEmptyDir(dir string, timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		entries, _ := os.ReadDir(dir)
+		if len(entries) == 0 || time.Now().After(deadline) {
+			names := make([]string, len(entries))
+			for i, entry := range entries {
+				names[i] = entry.Name()
+			}
+			return names
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// streamApp serves streamConversion for fake's deck, with opts on top of its client
+func streamApp(t *testing.T, fake *fakeSlideShare, conversionType SlidesConversionType, opts ConversionOptions) *fiber.App {
+	t.Helper()
+	deck := fake.deckURL(t)
+	opts.Client = fake.client()
+	app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		params := &ConvertParams{URL: deck, ConversionType: conversionType, Quality: HD, Delivery: DeliveryStream}
+		return streamConversion(c, params, opts)
+	})
+	return app
+}
+
+func TestStreamArchive(t *testing.T) {
+	tests := []struct {
+		name        string
+		slides      int
+		breakImages bool
+		wantStatus  int
+		wantEntries int
+		wantAborted bool
+	}{
+		{name: "sends the archive", slides: 3, wantStatus: fiber.StatusOK, wantEntries: 3},
+		{name: "fails before the archive starts", slides: 0, wantStatus: fiber.StatusNotFound},
+		{name: "aborts when the archive fails", slides: 3, breakImages: true, wantStatus: fiber.StatusOK, wantAborted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := withTempDir(t)
+			fake := newFakeSlideShare(t, tt.slides)
+			var opts ConversionOptions
+			if tt.breakImages {
+				// Lose the downloads once they are all in, so the archive
+				// already being sent can't be finished
+				opts.Progress = func(phase string, done, total int) {
+					if phase == PhaseUploading {
+						matches, _ := filepath.Glob(filepath.Join(dir, "slide-*"))
+						for _, match := range matches {
+							os.Remove(match)
+						}
+					}
+				}
+			}
+
+			resp, err := streamApp(t, fake, ImagesZip, opts).Test(httptest.NewRequest("GET", "/", nil), -1)
+			if tt.wantAborted && err != nil {
+				// app.Test reports the connection fasthttp dropped
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			body, readErr := io.ReadAll(resp.Body)
+			if tt.wantAborted {
+				if readErr == nil {
+					t.Fatalf("read a complete %d byte body from a failed archive", len(body))
+				}
+				return
+			}
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if tt.wantEntries == 0 {
+				return
+			}
+
+			if got := resp.Header.Get(fiber.HeaderContentType); got != "application/zip" {
+				t.Errorf("Content-Type = %q, want application/zip", got)
+			}
+			archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			if err != nil {
+				t.Fatalf("response is not a ZIP: %v", err)
+			}
+			if len(archive.File) != tt.wantEntries {
+				t.Errorf("archive has %d entries, want %d", len(archive.File), tt.wantEntries)
+			}
+			// The downloads are removed when the conversion returns, just after the body ends
+			if leftovers := waitForEmptyDir(dir, time.Second); len(leftovers) != 0 {
+				t.Errorf("streaming left %v in the temp dir", leftovers)
+			}
+		})
+	}
+}
+
+func TestStreamConversionRemovesOutput(t *testing.T) {
+	dir := withTempDir(t)
+	fake := newFakeSlideShare(t, 2)
+
+	resp, err := streamApp(t, fake, PDF, ConversionOptions{}).Test(httptest.NewRequest("GET", "/", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(body, []byte("%PDF")) {
+		t.Fatalf("response is not a PDF: %q", body[:min(len(body), 16)])
+	}
+	if got := resp.Header.Get(fiber.HeaderContentLength); got != strconv.Itoa(len(body)) {
+		t.Errorf("Content-Length = %s, body has %d bytes", got, len(body))
+	}
+	if leftovers := waitForEmptyDir(dir, time.Second); len(leftovers) != 0 {
+		t.Errorf("streaming left %v in the temp dir", leftovers)
+	}
+}
+
+func TestRemoveOnClose(t *testing.T) {
+	dir := withTempDir(t)
+	file, err := os.CreateTemp(dir, "stream-*.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("output")
+	file.Seek(0, io.SeekStart)
+
+	body := removeOnClose{file}
+	if data, _ := io.ReadAll(body); string(data) != "output" {
+		t.Fatalf("read %q, want %q", data, "output")
+	}
+	if _, err := os.Stat(file.Name()); err != nil {
+		t.Fatalf("file removed before Close: %v", err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file.Name()); !os.IsNotExist(err) {
+		t.Errorf("file still there after Close: %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultTempSweepAge is how old a leftover temp file must be for the startup
+// sweep to remove it when TMP_SWEEP_AGE is unset
+const defaultTempSweepAge = time.Hour
+
+// tempFilePatterns match the temp files conversions create in tempDir
+var tempFilePatterns = []string{"slide-*", "slides-*", "stream-*"}
+
+// tempDir holds every conversion temp file, set from TMP_DIR
+var tempDir = os.TempDir()
+
+// tempSweep is set when TMP_SWEEP opts into removing leftover temp files
+var tempSweep bool
+
+// loadTempDir reads TMP_DIR, created if missing, falling back to the OS temp dir
+func loadTempDir() (string, error) {
+	value := strings.TrimSpace(os.Getenv("TMP_DIR"))
+	if value == "" {
+		return os.TempDir(), nil
+	}
+	if err := os.MkdirAll(value, 0o700); err != nil {
+		return "", fmt.Errorf("invalid TMP_DIR %q: %v", value, err)
+	}
+	return value, nil
+}
+
+// loadTempSweepAge reads TMP_SWEEP=true, which opts into removing leftovers
+// from crashed runs at startup, and TMP_SWEEP_AGE (e.g. "30m"), the minimum
+// age of a removed file. Zero means no sweep. The sweep needs its own
+// TMP_DIR, the OS temp dir is shared with other programs.
+func loadTempSweepAge() (time.Duration, error) {
+	sweep, err := envBool("TMP_SWEEP")
+	if err != nil || !sweep {
+		return 0, err
+	}
+	if strings.TrimSpace(os.Getenv("TMP_DIR")) == "" {
+		return 0, fmt.Errorf("TMP_SWEEP requires a dedicated TMP_DIR")
+	}
+	value := strings.TrimSpace(os.Getenv("TMP_SWEEP_AGE"))
+	if value == "" {
+		return defaultTempSweepAge, nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid TMP_SWEEP_AGE %q: must be a positive duration", value)
+	}
+	return age, nil
+}
+
+// removeTempFiles deletes conversion temp files in tempDir last modified
+// more than olderThan ago. Zero removes all of them.
+func removeTempFiles(olderThan time.Duration) {
+	cutoff := time.Now().Add(-olderThan)
+	for _, pattern := range tempFilePatterns {
+		matches, err := filepath.Glob(filepath.Join(tempDir, pattern))
+		if err != nil {
+			continue
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+				continue
+			}
+			if err := os.Remove(match); err == nil {
+				slog.Info("removed leftover temp file", "path", match)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveTempFiles(t *testing.T) {
+	saved := tempDir
+	tempDir = t.TempDir()
+	defer func() { tempDir = saved }()
+
+	old := time.Now().Add(-2 * time.Hour)
+	tests := []struct {
+		name     string
+		modified time.Time
+		wantKept bool
+	}{
+		{name: "slide-stale.jpg", modified: old},
+		{name: "slides-stale.pdf", modified: old},
+		{name: "stream-stale.zip", modified: old},
+		{name: "slide-fresh.jpg", modified: time.Now(), wantKept: true},
+		{name: "slides-fresh.pdf", modified: time.Now().Add(-30 * time.Minute), wantKept: true},
+		{name: "other-stale.txt", modified: old, wantKept: true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tempDir, tt.name)
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, tt.modified, tt.modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeTempFiles(time.Hour)
+
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(tempDir, tt.name))
+		if kept := err == nil; kept != tt.wantKept {
+			t.Errorf("%s kept = %v, want %v", tt.name, kept, tt.wantKept)
+		}
+	}
+}
+
+func TestLoadTempSweepAge(t *testing.T) {
+	tests := []struct {
+		name    string
+		sweep   string
+		dir     string
+		age     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "off by default"},
+		{name: "off when disabled", sweep: "false", dir: "/tmp/ssdl"},
+		{name: "default age", sweep: "true", dir: "/tmp/ssdl", want: defaultTempSweepAge},
+		{name: "custom age", sweep: "true", dir: "/tmp/ssdl", age: "30m", want: 30 * time.Minute},
+		{name: "needs its own TMP_DIR", sweep: "true", wantErr: true},
+		{name: "invalid age", sweep: "true", dir: "/tmp/ssdl", age: "-1h", wantErr: true},
+		{name: "invalid flag", sweep: "sometimes", dir: "/tmp/ssdl", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMP_SWEEP", tt.sweep)
+			t.Setenv("TMP_DIR", tt.dir)
+			t.Setenv("TMP_SWEEP_AGE", tt.age)
+			got, err := loadTempSweepAge()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("loadTempSweepAge() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
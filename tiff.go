@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"os"
+
+	"github.com/disintegration/imaging"
+)
+
+// TIFF compressions accepted by the tiff_compression param
+const (
+	TIFFCompressionNone    = "none"
+	TIFFCompressionDeflate = "deflate"
+)
+
+// TIFF tag IDs and field types used by writeMultiPageTIFF
+const (
+	tiffTagImageWidth      = 256
+	tiffTagImageLength     = 257
+	tiffTagBitsPerSample   = 258
+	tiffTagCompression     = 259
+	tiffTagPhotometric     = 262
+	tiffTagStripOffsets    = 273
+	tiffTagSamplesPerPixel = 277
+	tiffTagRowsPerStrip    = 278
+	tiffTagStripByteCounts = 279
+	tiffTagXResolution     = 282
+	tiffTagYResolution     = 283
+	tiffTagPlanarConfig    = 284
+	tiffTagResolutionUnit  = 296
+
+	tiffTypeShort    = 3
+	tiffTypeLong     = 4
+	tiffTypeRational = 5
+)
+
+// ConvertURLsToTIFF encodes all slides into one multi-page TIFF and uploads it to storage
+func ConvertURLsToTIFF(ctx context.Context, store Storage, imageURLs []string, tiffFilename string, opts ConversionOptions, stats *ConversionStats) (string, int64, error) {
+	// Download images
+	imagePaths, err := fetchImagesConcurrently(ctx, imageURLs, opts.concurrency(), opts, stats)
+	if err != nil {
+		return "", 0, err
+	}
+	defer removeFiles(imagePaths)
+
+	if len(imagePaths) == 0 {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: "No images to convert to TIFF"}
+	}
+
+	// Create temp TIFF file
+	tmpTIFF, err := os.CreateTemp(tempDir, "slides-*.tiff")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmpTIFF.Name())
+	defer tmpTIFF.Close()
+
+	if err := writeMultiPageTIFF(tmpTIFF, imagePaths, opts.TIFFCompression == TIFFCompressionDeflate); err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeConversionFailed, Detail: fmt.Sprintf("Failed to write TIFF: %v", err)}
+	}
+
+	// Upload to storage
+	downloadURL, size, err := store.Upload(ctx, tmpTIFF.Name(), buildRemotePath(tiffFilename, opts))
+	if err != nil {
+		return "", 0, &CustomAPIError{StatusCode: 500, Code: CodeUploadFailed, Detail: fmt.Sprintf("Upload failed: %v", err)}
+	}
+
+	return downloadURL, size, nil
+}
+
+// tiffEntry is one 12-byte IFD entry whose value fits in the offset field
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    uint32
+}
+
+// writeMultiPageTIFF writes a little-endian baseline TIFF with one 8-bit RGB
+// page per image, each stored as a single strip. golang.org/x/image/tiff
+// only encodes single images, so the IFD chain is written here: every page
+// is its strip followed by its IFD, and each IFD's next pointer is patched
+// once the following page has been placed.
+func writeMultiPageTIFF(out *os.File, imagePaths []string, deflate bool) error {
+	w := bufio.NewWriter(out)
+	var offset uint32
+
+	write := func(data []byte) error {
+		n, err := w.Write(data)
+		offset += uint32(n)
+		return err
+	}
+
+	// Header, the first IFD pointer is patched below
+	if err := write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	nextPointerAt := int64(4)
+
+	compression := uint32(1)
+	if deflate {
+		compression = 8
+	}
+
+	for _, imgPath := range imagePaths {
+		img, err := imaging.Open(imgPath)
+		if err != nil {
+			return err
+		}
+		strip, err := tiffStrip(img, deflate)
+		if err != nil {
+			return err
+		}
+		width, height := uint32(img.Bounds().Dx()), uint32(img.Bounds().Dy())
+
+		// Strip data, padded to a word boundary as TIFF offsets should be even
+		stripOffset := offset
+		if err := write(strip); err != nil {
+			return err
+		}
+		if offset%2 == 1 {
+			if err := write([]byte{0}); err != nil {
+				return err
+			}
+		}
+
+		// Out-of-line values: BitsPerSample and the two resolutions
+		bitsOffset := offset
+		if err := write([]byte{8, 0, 8, 0, 8, 0}); err != nil {
+			return err
+		}
+		resolutionOffset := offset
+		resolution := make([]byte, 8)
+		binary.LittleEndian.PutUint32(resolution[0:], 72)
+		binary.LittleEndian.PutUint32(resolution[4:], 1)
+		if err := write(resolution); err != nil {
+			return err
+		}
+		if err := write(resolution); err != nil {
+			return err
+		}
+
+		entries := []tiffEntry{
+			{tiffTagImageWidth, tiffTypeLong, 1, width},
+			{tiffTagImageLength, tiffTypeLong, 1, height},
+			{tiffTagBitsPerSample, tiffTypeShort, 3, bitsOffset},
+			{tiffTagCompression, tiffTypeShort, 1, compression},
+			{tiffTagPhotometric, tiffTypeShort, 1, 2}, // RGB
+			{tiffTagStripOffsets, tiffTypeLong, 1, stripOffset},
+			{tiffTagSamplesPerPixel, tiffTypeShort, 1, 3},
+			{tiffTagRowsPerStrip, tiffTypeLong, 1, height},
+			{tiffTagStripByteCounts, tiffTypeLong, 1, uint32(len(strip))},
+			{tiffTagXResolution, tiffTypeRational, 1, resolutionOffset},
+			{tiffTagYResolution, tiffTypeRational, 1, resolutionOffset + 8},
+			{tiffTagPlanarConfig, tiffTypeShort, 1, 1},
+			{tiffTagResolutionUnit, tiffTypeShort, 1, 2}, // inches
+		}
+
+		// Point the previous IFD (or the header) at this one
+		ifdOffset := offset
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		pointer := make([]byte, 4)
+		binary.LittleEndian.PutUint32(pointer, ifdOffset)
+		if _, err := out.WriteAt(pointer, nextPointerAt); err != nil {
+			return err
+		}
+
+		ifd := make([]byte, 2+12*len(entries)+4)
+		binary.LittleEndian.PutUint16(ifd, uint16(len(entries)))
+		for i, e := range entries {
+			b := ifd[2+12*i:]
+			binary.LittleEndian.PutUint16(b[0:], e.tag)
+			binary.LittleEndian.PutUint16(b[2:], e.typ)
+			binary.LittleEndian.PutUint32(b[4:], e.count)
+			if e.typ == tiffTypeShort && e.count == 1 {
+				binary.LittleEndian.PutUint16(b[8:], uint16(e.value))
+			} else {
+				binary.LittleEndian.PutUint32(b[8:], e.value)
+			}
+		}
+		// Next IFD pointer stays 0 unless another page follows
+		nextPointerAt = int64(ifdOffset) + int64(len(ifd)) - 4
+		if err := write(ifd); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+// tiffStrip returns the image as packed 8-bit RGB rows, zlib-compressed when
+// deflate is set. The pages have no alpha channel, so transparent PNG and
+// WebP slides are flattened onto white like JPEG outputs.
+func tiffStrip(img image.Image, deflate bool) ([]byte, error) {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(nrgba, nrgba.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	var buf bytes.Buffer
+	var dst io.Writer = &buf
+	var zw *zlib.Writer
+	if deflate {
+		zw = zlib.NewWriter(&buf)
+		dst = zw
+	}
+
+	row := make([]byte, width*3)
+	for y := 0; y < height; y++ {
+		src := nrgba.Pix[y*nrgba.Stride:]
+		for x := 0; x < width; x++ {
+			copy(row[x*3:x*3+3], src[x*4:x*4+3])
+		}
+		if _, err := dst.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// tiffPageSizes walks the IFD chain of a little-endian TIFF and returns the
+// width and height of every page
+func tiffPageSizes(t *testing.T, data []byte) []image.Point {
+	t.Helper()
+	if len(data) < 8 || string(data[:4]) != "II*\x00" {
+		t.Fatalf("not a little-endian TIFF: % x", data[:min(len(data), 8)])
+	}
+	var pages []image.Point
+	for offset := binary.LittleEndian.Uint32(data[4:]); offset != 0; {
+		if int(offset)+2 > len(data) || len(pages) > 100 {
+			t.Fatalf("IFD offset %d runs past the file", offset)
+		}
+		count := int(binary.LittleEndian.Uint16(data[offset:]))
+		entries := data[offset+2:]
+		var page image.Point
+		for i := 0; i < count; i++ {
+			entry := entries[12*i:]
+			switch binary.LittleEndian.Uint16(entry) {
+			case tiffTagImageWidth:
+				page.X = int(binary.LittleEndian.Uint32(entry[8:]))
+			case tiffTagImageLength:
+				page.Y = int(binary.LittleEndian.Uint32(entry[8:]))
+			}
+		}
+		pages = append(pages, page)
+		offset = binary.LittleEndian.Uint32(entries[12*count:])
+	}
+	return pages
+}
+
+// writeTransparentPNG saves a width x height PNG whose left half is clear
+// and right half opaque blue, returning its path
+func writeTransparentPNG(t *testing.T, dir string, width, height int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := width / 2; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	imgPath := filepath.Join(dir, "transparent.png")
+	if err := os.WriteFile(imgPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return imgPath
+}
+
+func TestWriteMultiPageTIFF(t *testing.T) {
+	tests := []struct {
+		name    string
+		deflate bool
+	}{
+		{name: "uncompressed", deflate: false},
+		{name: "deflate", deflate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			imagePaths := []string{
+				writeTransparentPNG(t, dir, 40, 30),
+				writeSlideJPEG(t, dir, 400, 300),
+				writeSlideJPEG(t, dir, 300, 600),
+			}
+			wantSizes := []image.Point{{40, 30}, {400, 300}, {300, 600}}
+
+			out, err := os.Create(filepath.Join(dir, "out.tiff"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeMultiPageTIFF(out, imagePaths, tt.deflate); err != nil {
+				t.Fatal(err)
+			}
+			out.Close()
+			data, err := os.ReadFile(out.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sizes := tiffPageSizes(t, data)
+			if len(sizes) != len(wantSizes) {
+				t.Fatalf("TIFF has %d pages, want %d", len(sizes), len(wantSizes))
+			}
+			for i, size := range sizes {
+				if size != wantSizes[i] {
+					t.Errorf("page %d is %v, want %v", i+1, size, wantSizes[i])
+				}
+			}
+
+			// The decoder reads the first page, the transparent slide
+			first, err := tiff.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("first page does not decode: %v", err)
+			}
+			if first.Bounds().Size() != wantSizes[0] {
+				t.Errorf("first page decodes as %v, want %v", first.Bounds().Size(), wantSizes[0])
+			}
+			checks := []struct {
+				x    int
+				want color.RGBA
+			}{
+				{x: 5, want: color.RGBA{R: 255, G: 255, B: 255, A: 255}},
+				{x: 35, want: color.RGBA{B: 255, A: 255}},
+			}
+			for _, check := range checks {
+				r, g, b, a := first.At(check.x, 15).RGBA()
+				got := color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+				if got != check.want {
+					t.Errorf("pixel at x=%d is %v, want %v", check.x, got, check.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates every span. It is a no-op until loadTracing installs an
+// exporting provider.
+var tracer = otel.Tracer("ssdl")
+
+// tracerProvider is set when OTLP export is configured, shutdown flushes it
+var tracerProvider *sdktrace.TracerProvider
+
+// loadTracing exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter reads the rest
+// of the standard OTEL_* variables (headers, timeout, TLS) itself, and
+// OTEL_SERVICE_NAME names the service. Incoming W3C trace context is always
+// honored so spans join the caller's trace.
+func loadTracing(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")) == "" && strings.TrimSpace(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")) == "" {
+		return nil, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.Environment())
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider, nil
+}
+
+// shutdownTracing flushes buffered spans, when tracing is enabled
+func shutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// endSpan marks span failed with err, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingMiddleware starts a server span per request, continuing the
+// trace from the request's traceparent header, and stores it in the user
+// context so the pipeline's spans become its children
+func tracingMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		carrier := propagation.HeaderCarrier{}
+		c.Request().Header.VisitAll(func(key, value []byte) {
+			carrier.Set(string(key), string(value))
+		})
+		ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), carrier)
+
+		ctx, span := tracer.Start(ctx, c.Method(), trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", c.Method()),
+			attribute.String("url.path", c.Path()),
+		))
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+
+		// The route is only known once routing reached a handler
+		status := responseStatus(c, err)
+		span.SetName(c.Method() + " " + c.Route().Path)
+		span.SetAttributes(
+			attribute.String("http.route", c.Route().Path),
+			attribute.Int("http.response.status_code", status),
+		)
+		if status >= fiber.StatusInternalServerError {
+			endSpan(span, err)
+		} else {
+			span.End()
+		}
+		return err
+	}
+}
+
+// tracingStorage records a span for every upload, parented to the upload's ctx
+type tracingStorage struct {
+	Storage
+}
+
+func (s tracingStorage) Upload(ctx context.Context, localPath, remotePath string) (string, int64, error) {
+	ctx, span := tracer.Start(ctx, "upload", trace.WithAttributes(attribute.String("remote_path", remotePath)))
+	publicURL, size, err := s.Storage.Upload(ctx, localPath, remotePath)
+	span.SetAttributes(attribute.Int64("size", size))
+	endSpan(span, err)
+	return publicURL, size, err
+}
+
+// tracingStreamStorage is a tracingStorage for backends that stream uploads
+type tracingStreamStorage struct {
+	tracingStorage
+	streamer streamUploader
+}
+
+func (s tracingStreamStorage) UploadStream(ctx context.Context, r io.Reader, remotePath string) (string, error) {
+	ctx, span := tracer.Start(ctx, "upload", trace.WithAttributes(attribute.String("remote_path", remotePath)))
+	publicURL, err := s.streamer.UploadStream(ctx, r, remotePath)
+	endSpan(span, err)
+	return publicURL, err
+}
+
+// withTracing wraps store so uploads are traced, keeping its streaming support
+func withTracing(store Storage) Storage {
+	wrapped := tracingStorage{Storage: store}
+	if streamer, ok := store.(streamUploader); ok {
+		return tracingStreamStorage{tracingStorage: wrapped, streamer: streamer}
+	}
+	return wrapped
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// defaultWatermarkOpacity applies when WATERMARK_OPACITY is unset
+const defaultWatermarkOpacity = 0.5
+
+// watermarkNone as the watermark param turns off the env default watermark
+const watermarkNone = "none"
+
+var (
+	watermarkImageOnce sync.Once
+	watermarkImage     image.Image
+)
+
+// loadWatermarkImage reads WATERMARK_IMAGE once. Every slide gets it when set;
+// a missing or unreadable file is logged and disables the image watermark.
+func loadWatermarkImage() image.Image {
+	watermarkImageOnce.Do(func() {
+		path := strings.TrimSpace(os.Getenv("WATERMARK_IMAGE"))
+		if path == "" {
+			return
+		}
+		img, err := imaging.Open(path)
+		if err != nil {
+			slog.Warn("failed to load WATERMARK_IMAGE", "path", path, "error", err)
+			return
+		}
+		watermarkImage = img
+	})
+	return watermarkImage
+}
+
+// resolveWatermark applies the env defaults to a request's watermark param.
+// The request overrides the env: its text replaces WATERMARK_TEXT, and
+// "none" drops WATERMARK_IMAGE as well. Without the param both defaults apply.
+func resolveWatermark(param string) (text string, disabled bool) {
+	switch {
+	case strings.EqualFold(param, watermarkNone):
+		return "", true
+	case param != "":
+		return param, false
+	default:
+		return strings.TrimSpace(os.Getenv("WATERMARK_TEXT")), false
+	}
+}
+
+// watermarkOpacity reads WATERMARK_OPACITY, from 0 (invisible) to 1 (opaque)
+func watermarkOpacity() float64 {
+	if v, err := strconv.ParseFloat(os.Getenv("WATERMARK_OPACITY"), 64); err == nil && v >= 0 && v <= 1 {
+		return v
+	}
+	return defaultWatermarkOpacity
+}
+
+var watermarkFont = func() *opentype.Font {
+	f, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}()
+
+// hasWatermark reports whether fetchImage has to draw anything onto slides
+func (c fetchConfig) hasWatermark() bool {
+	return !c.NoWatermark && (c.Watermark != "" || loadWatermarkImage() != nil)
+}
+
+// applyWatermark draws the WATERMARK_IMAGE and then the text watermark into
+// the bottom-right corner of img, both scaled to the slide width
+func applyWatermark(ctx context.Context, img image.Image, text string) image.Image {
+	out := imaging.Clone(img)
+	bounds := out.Bounds()
+	margin := bounds.Dx() / 40
+	bottom := bounds.Dy() - margin
+	opacity := watermarkOpacity()
+
+	if mark := loadWatermarkImage(); mark != nil {
+		mark = imaging.Resize(mark, bounds.Dx()/6, 0, imaging.Lanczos)
+		pos := image.Pt(bounds.Dx()-margin-mark.Bounds().Dx(), bottom-mark.Bounds().Dy())
+		out = imaging.Overlay(out, mark, pos, opacity)
+		bottom = pos.Y - margin/2
+	}
+
+	if text != "" {
+		if mark := renderWatermarkText(ctx, text, float64(bounds.Dx())/40); mark != nil {
+			pos := image.Pt(bounds.Dx()-margin-mark.Bounds().Dx(), bottom-mark.Bounds().Dy())
+			out = imaging.Overlay(out, mark, pos, opacity)
+		}
+	}
+	return out
+}
+
+// renderWatermarkText draws white text with a dark outline onto a
+// transparent canvas sized to fit it
+func renderWatermarkText(ctx context.Context, text string, size float64) *image.NRGBA {
+	if size < 10 {
+		size = 10
+	}
+	face, err := opentype.NewFace(watermarkFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		loggerFrom(ctx).Warn("failed to create watermark font face", "error", err)
+		return nil
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	pad := int(size / 6)
+	width := font.MeasureString(face, text).Ceil() + 2*pad
+	height := (metrics.Ascent + metrics.Descent).Ceil() + 2*pad
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+
+	baseline := fixed.I(pad) + metrics.Ascent
+	drawer := &font.Drawer{Dst: canvas, Face: face}
+	for _, offset := range []image.Point{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+		drawer.Src = image.NewUniform(color.NRGBA{A: 200})
+		drawer.Dot = fixed.Point26_6{X: fixed.I(pad + offset.X), Y: baseline + fixed.I(offset.Y)}
+		drawer.DrawString(text)
+	}
+	drawer.Src = image.NewUniform(color.White)
+	drawer.Dot = fixed.Point26_6{X: fixed.I(pad), Y: baseline}
+	drawer.DrawString(text)
+
+	return canvas
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/disintegration/imaging"
+)
+
+func TestResolveWatermark(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          string
+		param        string
+		wantText     string
+		wantDisabled bool
+	}{
+		{name: "no default, no param", wantText: ""},
+		{name: "env default applies", env: "Acme", wantText: "Acme"},
+		{name: "request text overrides env", env: "Acme", param: "Draft", wantText: "Draft"},
+		{name: "none disables env default", env: "Acme", param: "none", wantDisabled: true},
+		{name: "none is case-insensitive", env: "Acme", param: "NONE", wantDisabled: true},
+		{name: "request text without env", param: "Draft", wantText: "Draft"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATERMARK_TEXT", tt.env)
+			params := &ConvertParams{Watermark: tt.param}
+			params.normalize()
+			opts, err := params.options()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Watermark != tt.wantText || opts.NoWatermark != tt.wantDisabled {
+				t.Errorf("watermark = %q, disabled %v; want %q, disabled %v", opts.Watermark, opts.NoWatermark, tt.wantText, tt.wantDisabled)
+			}
+			if tt.wantDisabled && opts.fetchConfig().hasWatermark() {
+				t.Error("watermark=none still draws a watermark")
+			}
+		})
+	}
+}
+
+// withWatermarkImage makes imgPath the WATERMARK_IMAGE for the rest of the
+// test, empty for none
+func withWatermarkImage(t *testing.T, imgPath string) {
+	t.Helper()
+	t.Setenv("WATERMARK_IMAGE", imgPath)
+	watermarkImageOnce, watermarkImage = sync.Once{}, nil
+	t.Cleanup(func() { watermarkImageOnce, watermarkImage = sync.Once{}, nil })
+}
+
+// changedPixels counts the pixels of rect that differ between a and b
+func changedPixels(a, b image.Image, rect image.Rectangle) int {
+	changed := 0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if a.At(x, y) != b.At(x, y) {
+				changed++
+			}
+		}
+	}
+	return changed
+}
+
+func TestApplyWatermark(t *testing.T) {
+	dir := t.TempDir()
+	logo := imaging.New(60, 30, color.NRGBA{R: 255, A: 255})
+	logoPath := filepath.Join(dir, "logo.png")
+	if err := imaging.Save(logo, logoPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		image       string
+		opacity     string
+		wantChanged bool
+	}{
+		{name: "text", text: "CONFIDENTIAL", wantChanged: true},
+		{name: "image", image: logoPath, wantChanged: true},
+		{name: "image and text", text: "Acme", image: logoPath, wantChanged: true},
+		{name: "nothing to draw", wantChanged: false},
+		{name: "invisible", text: "CONFIDENTIAL", opacity: "0", wantChanged: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withWatermarkImage(t, tt.image)
+			t.Setenv("WATERMARK_OPACITY", tt.opacity)
+			slide := imaging.New(800, 600, color.NRGBA{R: 40, G: 90, B: 160, A: 255})
+
+			out := applyWatermark(context.Background(), slide, tt.text)
+
+			if out.Bounds() != slide.Bounds() {
+				t.Fatalf("watermarked slide is %v, want %v", out.Bounds(), slide.Bounds())
+			}
+			corner := image.Rect(400, 300, 800, 600)
+			changed := changedPixels(slide, out, corner)
+			if tt.wantChanged && changed == 0 {
+				t.Error("bottom-right corner is unchanged, no watermark was drawn")
+			}
+			if !tt.wantChanged && changed != 0 {
+				t.Errorf("%d pixels changed, want none", changed)
+			}
+			// The mark stays in its corner
+			if rest := changedPixels(slide, out, image.Rect(0, 0, 800, 300)); rest != 0 {
+				t.Errorf("%d pixels changed above the watermark corner", rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// defaultWebhookMaxAttempts applies when WEBHOOK_MAX_ATTEMPTS is unset
+	defaultWebhookMaxAttempts = 5
+	webhookBackoffBase        = time.Second
+	webhookBackoffMax         = 30 * time.Second
+	webhookTimeout            = 10 * time.Second
+	// webhookSignatureHeader carries "sha256=<hex HMAC of the body>" keyed by WEBHOOK_SECRET
+	webhookSignatureHeader = "X-Signature-256"
+)
+
+// webhookMaxAttempts reads how many deliveries are tried from WEBHOOK_MAX_ATTEMPTS
+func webhookMaxAttempts() int {
+	if v, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && v > 0 {
+		return v
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// callbackAllowedHosts returns the exact hostnames from CALLBACK_ALLOWED_HOSTS.
+// When set, callbacks may only go to these hosts, which are trusted even if
+// they resolve to private addresses. Otherwise any public host is accepted.
+func callbackAllowedHosts() map[string]bool {
+	allowed := make(map[string]bool)
+	for _, host := range strings.Split(os.Getenv("CALLBACK_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			allowed[host] = true
+		}
+	}
+	return allowed
+}
+
+// checkCallbackURL rejects a callback_url the server must not POST to:
+// anything without WEBHOOK_SECRET to sign it, non-http(s) or credentialed
+// URLs, hosts outside CALLBACK_ALLOWED_HOSTS and, without an allowlist,
+// hosts with no public address
+func checkCallbackURL(ctx context.Context, callbackURL string) error {
+	if os.Getenv("WEBHOOK_SECRET") == "" {
+		return &CustomAPIError{StatusCode: fiber.StatusNotImplemented, Code: CodeConfigError, Detail: "callback_url is unavailable, WEBHOOK_SECRET is not configured"}
+	}
+
+	u, err := url.Parse(callbackURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User != nil || u.Hostname() == "" {
+		return &CustomAPIError{StatusCode: fiber.StatusBadRequest, Code: CodeInvalidURL, Detail: "Invalid callback_url"}
+	}
+	host := strings.ToLower(u.Hostname())
+	if allowed := callbackAllowedHosts(); len(allowed) > 0 {
+		if !allowed[host] {
+			return &CustomAPIError{StatusCode: fiber.StatusForbidden, Code: CodeHostNotAllowed, Detail: "callback_url host is not allowed"}
+		}
+		return nil
+	}
+	if _, err := publicIPs(ctx, host); err != nil {
+		return &CustomAPIError{StatusCode: fiber.StatusForbidden, Code: CodeHostNotAllowed, Detail: "callback_url must resolve to a public address"}
+	}
+	return nil
+}
+
+// webhookDial connects to allowlisted callback hosts directly and to
+// anything else only at public addresses
+func webhookDial() fasthttp.DialFunc {
+	allowed := callbackAllowedHosts()
+	return func(addr string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(addr); err == nil && allowed[strings.ToLower(host)] {
+			return fasthttp.Dial(addr)
+		}
+		return publicDial(addr)
+	}
+}
+
+// signWebhookBody returns the signature header value, or "" when WEBHOOK_SECRET is unset
+func signWebhookBody(body []byte) string {
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverWebhook POSTs payload to callbackURL, retrying non-2xx responses and
+// network errors with exponential backoff until ctx is done. Nothing is sent
+// unsigned, a missing WEBHOOK_SECRET drops the delivery.
+func deliverWebhook(ctx context.Context, callbackURL string, payload interface{}) {
+	logger := loggerFrom(ctx).With("callback_url", callbackURL)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("failed to encode webhook payload", "error", err)
+		return
+	}
+	signature := signWebhookBody(body)
+	if signature == "" {
+		logger.Warn("webhook not sent, WEBHOOK_SECRET is unset")
+		return
+	}
+
+	client := &fasthttp.Client{Dial: webhookDial()}
+	backoff := webhookBackoffBase
+	maxAttempts := webhookMaxAttempts()
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err := postWebhook(ctx, client, callbackURL, body, signature)
+		if err == nil {
+			logger.Info("webhook delivered", "attempt", attempt)
+			return
+		}
+		logger.Warn("webhook attempt failed", "attempt", attempt, "max_attempts", maxAttempts, "error", err)
+
+		if attempt < maxAttempts {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				logger.Error("webhook delivery abandoned", "attempts", attempt, "error", ctx.Err())
+				return
+			case <-timer.C:
+			}
+			if backoff *= 2; backoff > webhookBackoffMax {
+				backoff = webhookBackoffMax
+			}
+		}
+	}
+	logger.Error("webhook delivery abandoned", "attempts", maxAttempts)
+}
+
+func postWebhook(ctx context.Context, client *fasthttp.Client, callbackURL string, body []byte, signature string) error {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(callbackURL)
+	req.Header.SetMethod(fasthttp.MethodPost)
+	req.Header.SetContentType("application/json")
+	req.Header.Set(webhookSignatureHeader, signature)
+	req.SetBody(body)
+
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	// Redirects are not followed, they would skip checkCallbackURL
+	if err := doWithContext(ctx, client, req, resp, webhookTimeout); err != nil {
+		return err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode())
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Default name_pattern of each ZIP layout
+const (
+	defaultFlatNamePattern    = "image_{index}.{ext}"
+	defaultGalleryNamePattern = "slide_{index}.{ext}"
+)
+
+// namePatternTokens are the placeholders name_pattern accepts
+var namePatternTokens = strings.NewReplacer("{index}", "", "{title}", "", "{ext}", "")
+
+var namePatternLiteral = regexp.MustCompile(`^[A-Za-z0-9._-]*$`)
+
+// validateNamePattern checks a name_pattern holds {index}, so entries can't
+// collide, and nothing besides the known tokens and filename-safe characters
+func validateNamePattern(pattern string) error {
+	if !strings.Contains(pattern, "{index}") {
+		return fmt.Errorf("name_pattern must contain {index}")
+	}
+	if !namePatternLiteral.MatchString(namePatternTokens.Replace(pattern)) {
+		return fmt.Errorf("name_pattern may only use {index}, {title}, {ext} and letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
+
+// zipNaming names the slide entries of an archive. Indexes are zero-padded
+// to the width of the slide count so entries sort in slide order.
+type zipNaming struct {
+	pattern string
+	title   string
+	width   int
+}
+
+// newZipNaming falls back to fallback when pattern is empty
+func newZipNaming(pattern, fallback, title string, total int) zipNaming {
+	if pattern == "" {
+		pattern = fallback
+	}
+	return zipNaming{pattern: pattern, title: sanitizeFilename(title, ""), width: len(strconv.Itoa(total))}
+}
+
+// name is the entry name of slide i (0-based) stored from path
+func (n zipNaming) name(i int, path string) string {
+	return strings.NewReplacer(
+		"{index}", fmt.Sprintf("%0*d", n.width, i+1),
+		"{title}", n.title,
+		"{ext}", strings.TrimPrefix(filepath.Ext(path), "."),
+	).Replace(n.pattern)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestValidateNamePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{pattern: "image_{index}.{ext}"},
+		{pattern: "{title}-{index}.{ext}"},
+		{pattern: "{index}"},
+		{pattern: "slide.{ext}", wantErr: true},
+		{pattern: "", wantErr: true},
+		{pattern: "../{index}.{ext}", wantErr: true},
+		{pattern: "{index} copy.{ext}", wantErr: true},
+		{pattern: "{index}_{page}.{ext}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			err := validateNamePattern(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNamePattern(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestZipNamingName(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		fallback string
+		title    string
+		total    int
+		index    int
+		path     string
+		want     string
+	}{
+		{name: "fallback pattern", fallback: defaultFlatNamePattern, total: 5, index: 0, path: "/tmp/a.jpg", want: "image_1.jpg"},
+		{name: "pads to the slide count", fallback: defaultGalleryNamePattern, total: 120, index: 6, path: "/tmp/a.png", want: "slide_007.png"},
+		{name: "last slide fills the width", fallback: defaultFlatNamePattern, total: 10, index: 9, path: "/tmp/a.jpg", want: "image_10.jpg"},
+		{name: "custom pattern with title", pattern: "{title}_{index}.{ext}", fallback: defaultFlatNamePattern, title: "Deck", total: 3, index: 1, path: "/tmp/a.webp", want: "Deck_2.webp"},
+		{name: "path without extension", pattern: "{index}.{ext}", fallback: defaultFlatNamePattern, total: 1, index: 0, path: "/tmp/a", want: "1."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			naming := newZipNaming(tt.pattern, tt.fallback, tt.title, tt.total)
+			if got := naming.name(tt.index, tt.path); got != tt.want {
+				t.Errorf("name(%d, %q) = %q, want %q", tt.index, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteImagesZipEntriesSortInSlideOrder(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 12)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("slide-%d.jpg", i))
+		if err := os.WriteFile(paths[i], []byte(fmt.Sprint(i+1)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	naming := newZipNaming("", defaultFlatNamePattern, "", len(paths))
+	if err := writeImagesZip(&archive, paths, naming, nil); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(reader.File))
+	for i, entry := range reader.File {
+		names[i] = entry.Name
+	}
+	if len(names) != 12 || names[0] != "image_01.jpg" || names[11] != "image_12.jpg" {
+		t.Fatalf("entries = %v, want image_01.jpg through image_12.jpg", names)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("entries %v don't sort in slide order", names)
+	}
+}